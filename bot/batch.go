@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"weveryone_bot_v2/models"
+)
+
+const (
+	// maxMessageLength - максимальная длина текста сообщения в Telegram (в UTF-16)
+	maxMessageLength = 4096
+	// maxMentionsPerMessage - сколько упоминаний помещаем в одно сообщение,
+	// чтобы Telegram уведомил всех упомянутых
+	maxMentionsPerMessage = 50
+)
+
+// splitMentions разбивает пользователей на пачки так, чтобы текст каждой пачки
+// не превышал maxLength, а количество упоминаний - maxMentions
+func splitMentions(users []models.User, maxLength, maxMentions int) [][]models.User {
+	var batches [][]models.User
+	var current []models.User
+	length := 0
+
+	for _, user := range users {
+		labelLength := utf16Len(userLabel(user))
+
+		added := labelLength
+		if len(current) > 0 {
+			added++ // пробел-разделитель
+		}
+
+		if len(current) > 0 && (len(current) >= maxMentions || length+added > maxLength) {
+			batches = append(batches, current)
+			current = nil
+			length = 0
+			added = labelLength
+		}
+
+		current = append(current, user)
+		length += added
+	}
+
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// sendMentions отправляет упоминания пачками в исходном порядке
+// и возвращает количество отправленных сообщений
+func (b *TelegramBot) sendMentions(chatID int64, users []models.User) (int, error) {
+	batches := splitMentions(users, maxMessageLength, maxMentionsPerMessage)
+	for i, batch := range batches {
+		msg := newMentionMessage(chatID, batch)
+		if _, err := b.bot.Send(msg); err != nil {
+			return i, fmt.Errorf("ошибка отправки упоминаний (%d из %d): %v", i+1, len(batches), err)
+		}
+	}
+
+	if len(batches) > 1 {
+		log.Printf("Упоминания в чате %d отправлены %d сообщениями", chatID, len(batches))
+	}
+	return len(batches), nil
+}
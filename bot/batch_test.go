@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"weveryone_bot_v2/models"
+)
+
+// namedUsers создает пользователей без username с указанными именами
+func namedUsers(names ...string) []models.User {
+	users := make([]models.User, 0, len(names))
+	for i, name := range names {
+		users = append(users, models.User{UserID: int64(i + 1), FirstName: name})
+	}
+	return users
+}
+
+// batchSizes возвращает количество пользователей в каждой пачке
+func batchSizes(batches [][]models.User) []int {
+	sizes := make([]int, 0, len(batches))
+	for _, batch := range batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestSplitMentions(t *testing.T) {
+	cases := []struct {
+		name        string
+		users       []models.User
+		maxLength   int
+		maxMentions int
+		want        []int
+	}{
+		{"пустой список", nil, 10, 5, []int{}},
+		// "aaa bbb" - ровно 7 символов с пробелом
+		{"точно по длине", namedUsers("aaa", "bbb"), 7, 5, []int{2}},
+		{"на символ длиннее", namedUsers("aaa", "bbbb"), 7, 5, []int{1, 1}},
+		{"пробел не учитывается в начале пачки", namedUsers("aaaa", "bbbbbbb", "c"), 7, 5, []int{1, 1, 1}},
+		{"лимит упоминаний", namedUsers("a", "b", "c", "d", "e"), 100, 2, []int{2, 2, 1}},
+		// Кириллица занимает одну кодовую единицу UTF-16, эмодзи - две
+		{"кириллица", namedUsers("Иван", "Петр"), 9, 5, []int{2}},
+		{"эмодзи", namedUsers("😀😀", "😀😀"), 9, 5, []int{2}},
+		{"эмодзи на границе", namedUsers("😀😀", "😀😀😀"), 10, 5, []int{1, 1}},
+		// Слишком длинное имя отправляется отдельным сообщением и не тянет за собой соседей
+		{"длинное имя", namedUsers("a", strings.Repeat("x", 20), "b"), 10, 5, []int{1, 1, 1}},
+		{"длинное имя первым", namedUsers(strings.Repeat("x", 20), "a", "b"), 10, 5, []int{1, 2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			batches := splitMentions(tc.users, tc.maxLength, tc.maxMentions)
+			got := batchSizes(batches)
+			if len(got) != len(tc.want) {
+				t.Fatalf("размеры пачек %v, ожидалось %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("размеры пачек %v, ожидалось %v", got, tc.want)
+				}
+			}
+
+			// Пачки сохраняют исходный порядок пользователей
+			var order []models.User
+			for _, batch := range batches {
+				order = append(order, batch...)
+			}
+			for i, user := range order {
+				if user.UserID != tc.users[i].UserID {
+					t.Fatalf("нарушен порядок пользователей: %v", userLabels(order))
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMentionsTelegramLimits(t *testing.T) {
+	// 200 пользователей с именами по 30 символов: лимит в 50 упоминаний срабатывает раньше длины
+	short := make([]models.User, 200)
+	for i := range short {
+		short[i] = models.User{UserID: int64(i + 1), Username: strings.Repeat("u", 29)}
+	}
+	if got := batchSizes(splitMentions(short, maxMessageLength, maxMentionsPerMessage)); len(got) != 4 || got[0] != 50 {
+		t.Errorf("пачки коротких имен: %v", got)
+	}
+
+	// Имена по 128 кириллических символов: в 4096 помещается 31 имя с пробелами
+	long := make([]models.User, 40)
+	for i := range long {
+		long[i] = models.User{UserID: int64(i + 1), FirstName: strings.Repeat("я", 128)}
+	}
+	batches := splitMentions(long, maxMessageLength, maxMentionsPerMessage)
+	if got := batchSizes(batches); len(got) != 2 || got[0] != 31 || got[1] != 9 {
+		t.Errorf("пачки длинных имен: %v", got)
+	}
+	for _, batch := range batches {
+		text, entities := buildMentions(batch)
+		if n := utf16Len(text); n > maxMessageLength {
+			t.Errorf("длина сообщения %d превышает %d", n, maxMessageLength)
+		}
+		if len(entities) > maxMentionsPerMessage {
+			t.Errorf("в сообщении %d упоминаний", len(entities))
+		}
+	}
+}
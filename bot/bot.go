@@ -1,7 +1,9 @@
 package bot
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
 	"weveryone_bot_v2/interfaces"
@@ -12,12 +14,26 @@ import (
 
 const (
 	itemsPerPage = 15
+	// dbErrorText - ответ пользователю, когда данные не удалось прочитать из базы
+	dbErrorText = "Не удалось получить данные: ошибка базы данных. Попробуйте позже."
 )
 
+// botAPI описывает методы Telegram Bot API, которые использует бот
+type botAPI interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	GetChatAdministrators(config tgbotapi.ChatAdministratorsConfig) ([]tgbotapi.ChatMember, error)
+}
+
 type TelegramBot struct {
-	bot     *tgbotapi.BotAPI
-	db      interfaces.Database
-	adminID int64
+	bot        botAPI
+	db         interfaces.Database
+	adminID    int64
+	cooldowns  map[string]Cooldown
+	chatAdmins *chatAdminsCache
+	commands   *commandRegistry
+	flows      map[string]*conversationFlow
 }
 
 func NewTelegramBot(token string, adminID int64, db interfaces.Database) (*TelegramBot, error) {
@@ -26,11 +42,16 @@ func NewTelegramBot(token string, adminID int64, db interfaces.Database) (*Teleg
 		return nil, fmt.Errorf("ошибка создания бота: %v", err)
 	}
 
-	return &TelegramBot{
-		bot:     bot,
-		db:      db,
-		adminID: adminID,
-	}, nil
+	b := &TelegramBot{
+		bot:        bot,
+		db:         db,
+		adminID:    adminID,
+		cooldowns:  make(map[string]Cooldown),
+		chatAdmins: newChatAdminsCache(chatAdminsTTL),
+	}
+	b.commands = newCommandRegistry(b.newCommands())
+	b.flows = b.newFlows()
+	return b, nil
 }
 
 // GetUpdatesChan возвращает канал обновлений от Telegram
@@ -38,113 +59,68 @@ func (b *TelegramBot) GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.Upda
 	return b.bot.GetUpdatesChan(config)
 }
 
-func (b *TelegramBot) IsAdmin(userID int64) bool {
-	return userID == b.adminID
+// IsAdmin проверяет, есть ли у пользователя доступ к админ-панели в чате.
+// При chatID = 0 проверяется доступ к глобальной админ-панели.
+func (b *TelegramBot) IsAdmin(ctx context.Context, userID int64, chatID int64) bool {
+	return b.HasPermission(ctx, userID, chatID, PermAdminPanel)
 }
 
-func (b *TelegramBot) ShowAdminPanel(chatID int64) {
-	helpText := `Доступные команды:
-
-Основные команды:
-/all или /everyone - упомянуть всех пользователей в чате
-/group <название> - упомянуть пользователей определенной группы
-/help - показать это сообщение
-/start - показать админ-панель (только для администраторов)
-
-Команды администратора:
-/admin - показать админ-панель
-/add_user <user_id> <username> - добавить пользователя
-/del_user <user_id> - удалить пользователя
-/list_users - показать список пользователей
-/add_chat <chat_id> <title> - добавить чат
-/del_chat <chat_id> - удалить чат
-/list_chats - показать список чатов
-/add_group <name> - создать группу
-/del_group <name> - удалить группу
-/list_groups - показать список групп
-/add_to_chat <user_id> <chat_id> - добавить пользователя в чат
-/add_to_group <user_id> <group_name> - добавить пользователя в группу
-/link_group_chat <group_name> <chat_id> - связать группу с чатом
-/add_users_to_chat <chat_id> <user_id1> [user_id2 ...] - добавить несколько пользователей в чат`
+func (b *TelegramBot) ShowAdminPanel(chatID int64, update *tgbotapi.Update) {
+	helpText := b.commands.helpText()
 
 	msg := tgbotapi.NewMessage(chatID, helpText)
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("👥 Пользователи", "admin_users"),
-			tgbotapi.NewInlineKeyboardButtonData("➕ Создать пользователя", "create_user"),
+			b.button("👥 Пользователи", callback{Action: actUsers, Page: 1}),
+			b.button("➕ Создать пользователя", callback{Action: actCreateUser}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💬 Чаты", "admin_chats"),
-			tgbotapi.NewInlineKeyboardButtonData("➕ Создать чат", "create_chat"),
+			b.button("💬 Чаты", callback{Action: actChats, Page: 1}),
+			b.button("➕ Создать чат", callback{Action: actCreateChat}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("👥 Группы", "admin_groups"),
-			tgbotapi.NewInlineKeyboardButtonData("➕ Создать группу", "create_group"),
+			b.button("👥 Группы", callback{Action: actGroups, Page: 1}),
+			b.button("➕ Создать группу", callback{Action: actCreateGroup}),
 		),
 	)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
 func (b *TelegramBot) ShowHelp(chatID int64) {
-	helpText := `Доступные команды:
-
-Основные команды:
-/all или /everyone - упомянуть всех пользователей в чате
-/group <название> - упомянуть пользователей определенной группы
-/help - показать это сообщение
-/start - показать админ-панель (только для администраторов)
-
-Команды администратора:
-/admin - показать админ-панель
-/add_user <user_id> <username> - добавить пользователя
-/del_user <user_id> - удалить пользователя
-/list_users - показать список пользователей
-/add_chat <chat_id> <title> - добавить чат
-/del_chat <chat_id> - удалить чат
-/list_chats - показать список чатов
-/add_group <name> - создать группу
-/del_group <name> - удалить группу
-/list_groups - показать список групп
-/add_to_chat <user_id> <chat_id> - добавить пользователя в чат
-/add_to_group <user_id> <group_name> - добавить пользователя в группу
-/link_group_chat <group_name> <chat_id> - связать группу с чатом`
+	helpText := b.commands.helpText()
 
 	msg := tgbotapi.NewMessage(chatID, helpText)
 	b.bot.Send(msg)
 }
 
-func (b *TelegramBot) ShowViewMenu(chatID int64) {
+func (b *TelegramBot) ShowViewMenu(chatID int64, update *tgbotapi.Update) {
 	msg := tgbotapi.NewMessage(chatID, "Выберите, что хотите просмотреть:")
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Просмотр пользователей", "view_users"),
-			tgbotapi.NewInlineKeyboardButtonData("Просмотр чатов", "view_chats"),
+			b.button("Просмотр пользователей", callback{Action: actUsers, Page: 1}),
+			b.button("Просмотр чатов", callback{Action: actChats, Page: 1}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Просмотр групп", "view_groups"),
-			tgbotapi.NewInlineKeyboardButtonData("Просмотр связей", "view_relations"),
+			b.button("Просмотр групп", callback{Action: actGroups, Page: 1}),
+			b.button("Просмотр связей", callback{Action: actRelations}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_back"),
+			b.button("Назад", callback{Action: actAdminPanel}),
 		),
 	)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-// deleteMessage удаляет предыдущее сообщение
-func (b *TelegramBot) deleteMessage(chatID int64, messageID int) {
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, messageID)
-	b.bot.Send(deleteMsg)
-}
-
-func (b *TelegramBot) ShowUsersList(chatID int64, page int, update *tgbotapi.Update) {
-	// Удаляем предыдущее сообщение
-	if update != nil && update.CallbackQuery != nil {
-		b.deleteMessage(chatID, update.CallbackQuery.Message.MessageID)
+func (b *TelegramBot) ShowUsersList(ctx context.Context, chatID int64, page int, update *tgbotapi.Update) {
+	users, err := b.db.ListUsers(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "список пользователей", err, callback{Action: actAdminPanel}, update)
+		return
 	}
-
-	users := b.db.ListUsers()
 	totalPages := (len(users) + itemsPerPage - 1) / itemsPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -161,17 +137,17 @@ func (b *TelegramBot) ShowUsersList(chatID int64, page int, update *tgbotapi.Upd
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Список пользователей (страница %d из %d):\n\n", page, totalPages))
 	for _, user := range users[start:end] {
-		msgText.WriteString(fmt.Sprintf("ID: %d\nUsername: %s\n\n", user.UserID, user.Username))
+		msgText.WriteString(fmt.Sprintf("ID: %d\nПользователь: %s\n\n", user.UserID, userLabel(user)))
 	}
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	row := make([]tgbotapi.InlineKeyboardButton, 0)
 
 	if page > 1 {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("users_page_%d", page-1)))
+		row = append(row, b.button("◀️", callback{Action: actUsers, Page: page - 1}))
 	}
 	if page < totalPages {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("users_page_%d", page+1)))
+		row = append(row, b.button("▶️", callback{Action: actUsers, Page: page + 1}))
 	}
 	if len(row) > 0 {
 		rows = append(rows, row)
@@ -179,31 +155,33 @@ func (b *TelegramBot) ShowUsersList(chatID int64, page int, update *tgbotapi.Upd
 
 	for _, user := range users[start:end] {
 		rows = append(rows, []tgbotapi.InlineKeyboardButton{
-			tgbotapi.NewInlineKeyboardButtonData(
-				fmt.Sprintf("👤 %s", user.Username),
-				fmt.Sprintf("user_info_%d", user.UserID),
+			b.button(
+				fmt.Sprintf("👤 %s", userLabel(user)),
+				callback{Action: actUserInfo, UserID: user.UserID},
 			),
 		})
 	}
 
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("➕ Создать пользователя", "create_user"),
-		tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_back"),
+		b.button("➕ Создать пользователя", callback{Action: actCreateUser}),
+		b.button("Назад", callback{Action: actAdminPanel}),
 	})
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowChatsList(chatID int64, page int, update *tgbotapi.Update) {
-	// Удаляем предыдущее сообщение
-	if update != nil && update.CallbackQuery != nil {
-		b.deleteMessage(chatID, update.CallbackQuery.Message.MessageID)
+func (b *TelegramBot) ShowChatsList(ctx context.Context, chatID int64, page int, update *tgbotapi.Update) {
+	chats, err := b.db.ListChats(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "список чатов", err, callback{Action: actAdminPanel}, update)
+		return
 	}
-
-	chats := b.db.ListChats()
 	totalPages := (len(chats) + itemsPerPage - 1) / itemsPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -220,17 +198,21 @@ func (b *TelegramBot) ShowChatsList(chatID int64, page int, update *tgbotapi.Upd
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Список чатов (страница %d из %d):\n\n", page, totalPages))
 	for _, chat := range chats[start:end] {
-		msgText.WriteString(fmt.Sprintf("ID: %d\nTitle: %s\n\n", chat.ChatID, chat.Title))
+		msgText.WriteString(fmt.Sprintf("ID: %d\nTitle: %s\n", chat.ChatID, chat.Title))
+		if !chat.Active {
+			msgText.WriteString("Бот удален из чата\n")
+		}
+		msgText.WriteString("\n")
 	}
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	row := make([]tgbotapi.InlineKeyboardButton, 0)
 
 	if page > 1 {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("chats_page_%d", page-1)))
+		row = append(row, b.button("◀️", callback{Action: actChats, Page: page - 1}))
 	}
 	if page < totalPages {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("chats_page_%d", page+1)))
+		row = append(row, b.button("▶️", callback{Action: actChats, Page: page + 1}))
 	}
 	if len(row) > 0 {
 		rows = append(rows, row)
@@ -238,31 +220,33 @@ func (b *TelegramBot) ShowChatsList(chatID int64, page int, update *tgbotapi.Upd
 
 	for _, chat := range chats[start:end] {
 		rows = append(rows, []tgbotapi.InlineKeyboardButton{
-			tgbotapi.NewInlineKeyboardButtonData(
+			b.button(
 				fmt.Sprintf("💬 %s", chat.Title),
-				fmt.Sprintf("chat_info_%d", chat.ChatID),
+				callback{Action: actChatInfo, ChatID: chat.ChatID},
 			),
 		})
 	}
 
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("➕ Создать чат", "create_chat"),
-		tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_back"),
+		b.button("➕ Создать чат", callback{Action: actCreateChat}),
+		b.button("Назад", callback{Action: actAdminPanel}),
 	})
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowGroupsList(chatID int64, page int, update *tgbotapi.Update) {
-	// Удаляем предыдущее сообщение
-	if update != nil && update.CallbackQuery != nil {
-		b.deleteMessage(chatID, update.CallbackQuery.Message.MessageID)
+func (b *TelegramBot) ShowGroupsList(ctx context.Context, chatID int64, page int, update *tgbotapi.Update) {
+	groups, err := b.db.ListGroups(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "список групп", err, callback{Action: actAdminPanel}, update)
+		return
 	}
-
-	groups := b.db.ListGroups()
 	totalPages := (len(groups) + itemsPerPage - 1) / itemsPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -286,10 +270,10 @@ func (b *TelegramBot) ShowGroupsList(chatID int64, page int, update *tgbotapi.Up
 	row := make([]tgbotapi.InlineKeyboardButton, 0)
 
 	if page > 1 {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("groups_page_%d", page-1)))
+		row = append(row, b.button("◀️", callback{Action: actGroups, Page: page - 1}))
 	}
 	if page < totalPages {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("groups_page_%d", page+1)))
+		row = append(row, b.button("▶️", callback{Action: actGroups, Page: page + 1}))
 	}
 	if len(row) > 0 {
 		rows = append(rows, row)
@@ -297,38 +281,63 @@ func (b *TelegramBot) ShowGroupsList(chatID int64, page int, update *tgbotapi.Up
 
 	for _, group := range groups[start:end] {
 		rows = append(rows, []tgbotapi.InlineKeyboardButton{
-			tgbotapi.NewInlineKeyboardButtonData(
+			b.button(
 				fmt.Sprintf("👥 %s", group.Name),
-				fmt.Sprintf("group_info_%s", group.Name),
+				callback{Action: actGroupInfo, GroupID: group.ID},
 			),
 		})
 	}
 
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("➕ Создать группу", "create_group"),
-		tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_back"),
+		b.button("➕ Создать группу", callback{Action: actCreateGroup}),
+		b.button("Назад", callback{Action: actAdminPanel}),
 	})
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowUserInfo(chatID int64, userID int64) {
-	user, err := b.db.GetUser(userID)
+func (b *TelegramBot) ShowUserInfo(ctx context.Context, chatID int64, userID int64, update *tgbotapi.Update) {
+	user, err := b.db.GetUser(ctx, userID)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, "Ошибка получения информации о пользователе")
-		b.bot.Send(msg)
+		b.render(msg, update)
 		return
 	}
 
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Информация о пользователе:\n\n"))
 	msgText.WriteString(fmt.Sprintf("ID: %d\n", user.UserID))
-	msgText.WriteString(fmt.Sprintf("Username: %s\n", user.Username))
+	msgText.WriteString(fmt.Sprintf("Пользователь: %s\n", userLabel(*user)))
+	if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+		msgText.WriteString(fmt.Sprintf("Имя: %s\n", name))
+	}
+	if user.LanguageCode != "" {
+		msgText.WriteString(fmt.Sprintf("Язык: %s\n", user.LanguageCode))
+	}
+
+	back := callback{Action: actUsers, Page: 1}
+
+	// Получаем историю переименований
+	history, err := b.db.GetUsernameHistory(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о пользователе", err, back, update)
+		return
+	}
+	if len(history) > 0 {
+		msgText.WriteString("\nПредыдущие username:\n")
+		for _, item := range history {
+			msgText.WriteString(fmt.Sprintf("- @%s (до %s)\n", item.Username, item.ChangedAt.Format("02.01.2006")))
+		}
+	}
 
 	// Получаем чаты пользователя
-	chats := b.db.GetChatsForUser(userID)
+	chats, err := b.db.GetChatsForUser(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о пользователе", err, back, update)
+		return
+	}
 	if len(chats) > 0 {
 		msgText.WriteString("\nЧаты пользователя:\n")
 		for _, chat := range chats {
@@ -336,8 +345,38 @@ func (b *TelegramBot) ShowUserInfo(chatID int64, userID int64) {
 		}
 	}
 
+	// Получаем роли пользователя
+	roles, err := b.userRoles(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о пользователе", err, back, update)
+		return
+	}
+	if len(roles) > 0 {
+		msgText.WriteString("\nРоли:\n")
+		for _, role := range roles {
+			msgText.WriteString(fmt.Sprintf("- %s\n", describeRole(role)))
+		}
+	}
+
+	// Получаем отключенные упоминания
+	mutes, err := b.db.GetMentionMutes(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о пользователе", err, back, update)
+		return
+	}
+	if len(mutes) > 0 {
+		msgText.WriteString("\nОтключенные упоминания:\n")
+		for _, mute := range mutes {
+			msgText.WriteString(fmt.Sprintf("- %s: %s\n", b.describeMuteScope(ctx, mute), mute.Describe()))
+		}
+	}
+
 	// Получаем группы пользователя
-	groups := b.db.GetGroupsForUser(userID)
+	groups, err := b.db.GetGroupsForUser(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о пользователе", err, back, update)
+		return
+	}
 	if len(groups) > 0 {
 		msgText.WriteString("\nГруппы пользователя:\n")
 		for _, group := range groups {
@@ -347,68 +386,132 @@ func (b *TelegramBot) ShowUserInfo(chatID int64, userID int64) {
 
 	rows := [][]tgbotapi.InlineKeyboardButton{
 		{
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Редактировать", fmt.Sprintf("edit_user_%d", userID)),
-			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", fmt.Sprintf("delete_user_%d", userID)),
+			b.button("✏️ Редактировать", callback{Action: actEditUser, UserID: userID}),
+			b.button("🗑 Удалить", callback{Action: actDeleteUser, UserID: userID}),
 		},
 		{
-			tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_users"),
+			b.button("Назад", back),
 		},
 	}
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowChatInfo(chatID int64, targetChatID int64) {
-	chat, err := b.db.GetChat(targetChatID)
+func (b *TelegramBot) ShowChatInfo(ctx context.Context, chatID int64, targetChatID int64, update *tgbotapi.Update) {
+	chat, err := b.db.GetChat(ctx, targetChatID)
 	if err != nil {
 		msg := tgbotapi.NewMessage(chatID, "Ошибка получения информации о чате")
-		b.bot.Send(msg)
+		b.render(msg, update)
 		return
 	}
 
+	back := callback{Action: actChats, Page: 1}
+
 	// Получаем список пользователей чата
-	users := b.db.GetUsersForChat(targetChatID)
+	users, err := b.db.GetUsersForChat(ctx, targetChatID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о чате", err, back, update)
+		return
+	}
 	var usersList string
 	if len(users) > 0 {
 		usersList = "\n\nПользователи чата:\n"
 		for _, user := range users {
-			usersList += fmt.Sprintf("- @%s\n", user.Username)
+			usersList += fmt.Sprintf("- %s\n", userLabel(user))
 		}
 	} else {
 		usersList = "\n\nВ чате пока нет пользователей"
 	}
 
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Информация о чате:\nID: %d\nНазвание: %s%s",
-		chat.ChatID, chat.Title, usersList))
+	// Получаем пользователей, отключивших упоминания
+	mutes, err := b.db.GetMentionMutesForChat(ctx, targetChatID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о чате", err, back, update)
+		return
+	}
+	if len(mutes) > 0 {
+		usersList += "\n\nОтключили упоминания:\n"
+		for _, mute := range mutes {
+			label := fmt.Sprintf("%d", mute.UserID)
+			if user, err := b.db.GetUser(ctx, mute.UserID); err == nil {
+				label = userLabel(*user)
+			}
+			scope := "в этом чате"
+			if mute.IsGlobal() {
+				scope = "во всех чатах"
+			}
+			usersList += fmt.Sprintf("- %s (%s, %s)\n", label, scope, mute.Describe())
+		}
+	}
 
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	status := "активен"
+	if !chat.Active {
+		status = "бот удален из чата"
+	}
+
+	// Получаем группы, привязанные к чату
+	groups, err := b.db.GetGroupsForChat(ctx, targetChatID)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о чате", err, back, update)
+		return
+	}
+	if len(groups) > 0 {
+		usersList += "\n\nПривязанные группы:\n"
+		for _, group := range groups {
+			usersList += fmt.Sprintf("- %s\n", group.Name)
+		}
+	}
+	if len(users)+len(groups) > 0 {
+		usersList += "\nНажмите ➖, чтобы исключить пользователя из чата или отвязать группу."
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Информация о чате:\nID: %d\nНазвание: %s\nСтатус: %s%s",
+		chat.ChatID, chat.Title, status, usersList))
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("➕ Добавить пользователей", fmt.Sprintf("add_users_to_chat_%d", targetChatID)),
+			b.button("➕ Добавить пользователей", callback{Action: actUsersToChat, ChatID: targetChatID, Page: 1}),
 		),
+	}
+	rows = append(rows, b.removeButtons(users, func(user models.User) callback {
+		return callback{Action: actChatRemoveUser, ChatID: targetChatID, UserID: user.UserID}
+	})...)
+	for _, group := range groups {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.button(fmt.Sprintf("➖ 👥 %s", group.Name), callback{Action: actChatUnlinkGroup, ChatID: targetChatID, GroupID: group.ID}),
+		))
+	}
+	rows = append(rows,
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Редактировать", fmt.Sprintf("edit_chat_%d", targetChatID)),
-			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", fmt.Sprintf("delete_chat_%d", targetChatID)),
+			b.button("✏️ Редактировать", callback{Action: actEditChat, ChatID: targetChatID}),
+			b.button("🗑 Удалить", callback{Action: actDeleteChat, ChatID: targetChatID}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_chats"),
+			b.button("Назад", back),
 		),
 	)
-	b.bot.Send(msg)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowUsersToAddToChat(chatID int64, targetChatID int64, page int, update *tgbotapi.Update) {
-	// Удаляем предыдущее сообщение
-	if update != nil && update.CallbackQuery != nil {
-		b.deleteMessage(chatID, update.CallbackQuery.Message.MessageID)
-	}
+func (b *TelegramBot) ShowUsersToAddToChat(ctx context.Context, chatID int64, targetChatID int64, page int, update *tgbotapi.Update) {
+	back := callback{Action: actChatInfo, ChatID: targetChatID}
 
 	// Получаем всех пользователей
-	allUsers := b.db.ListUsers()
+	allUsers, err := b.db.ListUsers(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "список пользователей", err, back, update)
+		return
+	}
 
 	// Получаем пользователей, которые уже в чате
-	chatUsers := b.db.GetUsersForChat(targetChatID)
+	chatUsers, err := b.db.GetUsersForChat(ctx, targetChatID)
+	if err != nil {
+		b.renderLoadError(chatID, "список пользователей", err, back, update)
+		return
+	}
 	chatUserMap := make(map[int64]bool)
 	for _, user := range chatUsers {
 		chatUserMap[user.UserID] = true
@@ -427,14 +530,17 @@ func (b *TelegramBot) ShowUsersToAddToChat(chatID int64, targetChatID int64, pag
 		msg := tgbotapi.NewMessage(chatID, "Нет доступных пользователей для добавления в чат")
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("chat_info_%d", targetChatID)),
+				b.button("Назад", callback{Action: actChatInfo, ChatID: targetChatID}),
 			),
 		)
-		b.bot.Send(msg)
+		b.render(msg, update)
 		return
 	}
 
 	totalPages := (len(availableUsers) + itemsPerPage - 1) / itemsPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -451,17 +557,17 @@ func (b *TelegramBot) ShowUsersToAddToChat(chatID int64, targetChatID int64, pag
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Выберите пользователей для добавления в чат (страница %d из %d):\n\n", page, totalPages))
 	for _, user := range availableUsers[start:end] {
-		msgText.WriteString(fmt.Sprintf("ID: %d\nUsername: %s\n\n", user.UserID, user.Username))
+		msgText.WriteString(fmt.Sprintf("ID: %d\nПользователь: %s\n\n", user.UserID, userLabel(user)))
 	}
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	row := make([]tgbotapi.InlineKeyboardButton, 0)
 
 	if page > 1 {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("add_users_to_chat_page_%d_%d", targetChatID, page-1)))
+		row = append(row, b.button("◀️", callback{Action: actUsersToChat, ChatID: targetChatID, Page: page - 1}))
 	}
 	if page < totalPages {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("add_users_to_chat_page_%d_%d", targetChatID, page+1)))
+		row = append(row, b.button("▶️", callback{Action: actUsersToChat, ChatID: targetChatID, Page: page + 1}))
 	}
 	if len(row) > 0 {
 		rows = append(rows, row)
@@ -469,65 +575,107 @@ func (b *TelegramBot) ShowUsersToAddToChat(chatID int64, targetChatID int64, pag
 
 	for _, user := range availableUsers[start:end] {
 		rows = append(rows, []tgbotapi.InlineKeyboardButton{
-			tgbotapi.NewInlineKeyboardButtonData(
-				fmt.Sprintf("➕ @%s", user.Username),
-				fmt.Sprintf("add_user_to_chat_%d_%d", targetChatID, user.UserID),
+			b.button(
+				fmt.Sprintf("➕ %s", userLabel(user)),
+				callback{Action: actAddUserToChat, ChatID: targetChatID, UserID: user.UserID, Page: page},
 			),
 		})
 	}
 
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("chat_info_%d", targetChatID)),
+		b.button("Назад", callback{Action: actChatInfo, ChatID: targetChatID}),
 	})
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowGroupInfo(chatID int64, groupName string) {
-	group, err := b.db.GetGroup(groupName)
-	if err != nil {
-		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка получения информации о группе: %v", err))
-		b.bot.Send(msg)
+func (b *TelegramBot) ShowGroupInfo(ctx context.Context, chatID int64, groupID uint, update *tgbotapi.Update) {
+	back := callback{Action: actGroups, Page: 1}
+	group, ok := b.loadGroup(ctx, chatID, groupID, back, update)
+	if !ok {
 		return
 	}
+	groupName := group.Name
 
-	users := b.db.GetUsersForGroup(groupName)
+	users, err := b.db.GetUsersForGroup(ctx, groupName)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о группе", err, back, update)
+		return
+	}
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Информация о группе: %s\n\n", group.Name))
 	msgText.WriteString("Пользователи в группе:\n")
 	for _, user := range users {
-		msgText.WriteString(fmt.Sprintf("- @%s\n", user.Username))
+		msgText.WriteString(fmt.Sprintf("- %s\n", userLabel(user)))
 	}
 
-	msg := tgbotapi.NewMessage(chatID, msgText.String())
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	// Получаем чаты, к которым привязана группа
+	chats, err := b.db.GetChatsForGroup(ctx, groupName)
+	if err != nil {
+		b.renderLoadError(chatID, "информацию о группе", err, back, update)
+		return
+	}
+	if len(chats) > 0 {
+		msgText.WriteString("\nПривязана к чатам:\n")
+		for _, chat := range chats {
+			msgText.WriteString(fmt.Sprintf("- %s\n", chat.Title))
+		}
+	}
+	if len(users)+len(chats) > 0 {
+		msgText.WriteString("\nНажмите ➖, чтобы исключить пользователя из группы или отвязать ее от чата.")
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("➕ Добавить пользователей", fmt.Sprintf("add_users_to_group_%s", groupName)),
+			b.button("➕ Добавить пользователей", callback{Action: actUsersToGroup, GroupID: groupID, Page: 1}),
 		),
+	}
+	rows = append(rows, b.removeButtons(users, func(user models.User) callback {
+		return callback{Action: actGroupRemoveUser, GroupID: groupID, UserID: user.UserID}
+	})...)
+	for _, chat := range chats {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.button(fmt.Sprintf("➖ 💬 %s", chat.Title), callback{Action: actGroupUnlinkChat, GroupID: groupID, ChatID: chat.ChatID}),
+		))
+	}
+	rows = append(rows,
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Редактировать", fmt.Sprintf("edit_group_%s", groupName)),
-			tgbotapi.NewInlineKeyboardButtonData("🗑 Удалить", fmt.Sprintf("delete_group_%s", groupName)),
+			b.button("✏️ Редактировать", callback{Action: actEditGroup, GroupID: groupID}),
+			b.button("🗑 Удалить", callback{Action: actDeleteGroup, GroupID: groupID}),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_groups"),
+			b.button("Назад", back),
 		),
 	)
-	b.bot.Send(msg)
+
+	msg := tgbotapi.NewMessage(chatID, msgText.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowUsersToAddToGroup(chatID int64, groupName string, page int, update *tgbotapi.Update) {
-	// Удаляем предыдущее сообщение
-	if update != nil && update.CallbackQuery != nil {
-		b.deleteMessage(chatID, update.CallbackQuery.Message.MessageID)
+func (b *TelegramBot) ShowUsersToAddToGroup(ctx context.Context, chatID int64, groupID uint, page int, update *tgbotapi.Update) {
+	back := callback{Action: actGroupInfo, GroupID: groupID}
+	group, ok := b.loadGroup(ctx, chatID, groupID, callback{Action: actGroups, Page: 1}, update)
+	if !ok {
+		return
 	}
+	groupName := group.Name
 
 	// Получаем всех пользователей
-	allUsers := b.db.ListUsers()
+	allUsers, err := b.db.ListUsers(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "список пользователей", err, back, update)
+		return
+	}
 
 	// Получаем пользователей, которые уже в группе
-	groupUsers := b.db.GetUsersForGroup(groupName)
+	groupUsers, err := b.db.GetUsersForGroup(ctx, groupName)
+	if err != nil {
+		b.renderLoadError(chatID, "список пользователей", err, back, update)
+		return
+	}
 	groupUserMap := make(map[int64]bool)
 	for _, user := range groupUsers {
 		groupUserMap[user.UserID] = true
@@ -546,14 +694,17 @@ func (b *TelegramBot) ShowUsersToAddToGroup(chatID int64, groupName string, page
 		msg := tgbotapi.NewMessage(chatID, "Нет доступных пользователей для добавления в группу")
 		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("group_info_%s", groupName)),
+				b.button("Назад", callback{Action: actGroupInfo, GroupID: groupID}),
 			),
 		)
-		b.bot.Send(msg)
+		b.render(msg, update)
 		return
 	}
 
 	totalPages := (len(availableUsers) + itemsPerPage - 1) / itemsPerPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
 	if page < 1 {
 		page = 1
 	}
@@ -570,17 +721,17 @@ func (b *TelegramBot) ShowUsersToAddToGroup(chatID int64, groupName string, page
 	var msgText strings.Builder
 	msgText.WriteString(fmt.Sprintf("Выберите пользователей для добавления в группу %s (страница %d из %d):\n\n", groupName, page, totalPages))
 	for _, user := range availableUsers[start:end] {
-		msgText.WriteString(fmt.Sprintf("ID: %d\nUsername: %s\n\n", user.UserID, user.Username))
+		msgText.WriteString(fmt.Sprintf("ID: %d\nПользователь: %s\n\n", user.UserID, userLabel(user)))
 	}
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 	row := make([]tgbotapi.InlineKeyboardButton, 0)
 
 	if page > 1 {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("add_users_to_group_page_%s_%d", groupName, page-1)))
+		row = append(row, b.button("◀️", callback{Action: actUsersToGroup, GroupID: groupID, Page: page - 1}))
 	}
 	if page < totalPages {
-		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("add_users_to_group_page_%s_%d", groupName, page+1)))
+		row = append(row, b.button("▶️", callback{Action: actUsersToGroup, GroupID: groupID, Page: page + 1}))
 	}
 	if len(row) > 0 {
 		rows = append(rows, row)
@@ -589,560 +740,307 @@ func (b *TelegramBot) ShowUsersToAddToGroup(chatID int64, groupName string, page
 	// Добавляем кнопки для каждого пользователя
 	for _, user := range availableUsers[start:end] {
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("➕ Добавить @%s", user.Username),
-				fmt.Sprintf("add_user_to_group_%s_%d", groupName, user.UserID)),
+			b.button(fmt.Sprintf("➕ Добавить %s", userLabel(user)),
+				callback{Action: actAddUserToGroup, GroupID: groupID, UserID: user.UserID, Page: page}),
 		))
 	}
 
 	// Добавляем кнопку "Назад"
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("Назад", fmt.Sprintf("group_info_%s", groupName)),
+		b.button("Назад", callback{Action: actGroupInfo, GroupID: groupID}),
 	))
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) ShowRelations(chatID int64) {
-	chats := b.db.ListChats()
-	groups := b.db.ListGroups()
+func (b *TelegramBot) ShowRelations(ctx context.Context, chatID int64, update *tgbotapi.Update) {
+	back := callback{Action: actViewMenu}
+	chats, err := b.db.ListChats(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "связи", err, back, update)
+		return
+	}
+	groups, err := b.db.ListGroups(ctx)
+	if err != nil {
+		b.renderLoadError(chatID, "связи", err, back, update)
+		return
+	}
 
 	var msgText strings.Builder
 	msgText.WriteString("Связи в системе:\n\n")
 
 	msgText.WriteString("Пользователи в чатах:\n")
 	for _, chat := range chats {
-		users := b.db.GetUsersForMention(chat.ChatID, "")
+		users, err := b.db.GetUsersForMention(ctx, chat.ChatID, "")
+		if err != nil {
+			b.renderLoadError(chatID, "связи", err, back, update)
+			return
+		}
 		if len(users) > 0 {
-			msgText.WriteString(fmt.Sprintf("Чат %s (%d): %s\n", chat.Title, chat.ChatID, strings.Join(users, ", ")))
+			msgText.WriteString(fmt.Sprintf("Чат %s (%d): %s\n", chat.Title, chat.ChatID, strings.Join(userLabels(users), ", ")))
 		}
 	}
 	msgText.WriteString("\n")
 
 	msgText.WriteString("Пользователи в группах:\n")
 	for _, group := range groups {
-		users := b.db.GetUsersForMention(0, group.Name)
+		users, err := b.db.GetUsersForGroup(ctx, group.Name)
+		if err != nil {
+			b.renderLoadError(chatID, "связи", err, back, update)
+			return
+		}
 		if len(users) > 0 {
-			msgText.WriteString(fmt.Sprintf("Группа %s: %s\n", group.Name, strings.Join(users, ", ")))
+			msgText.WriteString(fmt.Sprintf("Группа %s: %s\n", group.Name, strings.Join(userLabels(users), ", ")))
 		}
 	}
 
 	msg := tgbotapi.NewMessage(chatID, msgText.String())
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_view"),
+			b.button("Назад", back),
 		),
 	)
-	b.bot.Send(msg)
+	b.render(msg, update)
 }
 
-func (b *TelegramBot) HandleCommand(update tgbotapi.Update) {
-	msg := update.Message
-	chatID := msg.Chat.ID
-	userID := msg.From.ID
-	command := msg.Command()
-
-	// Добавляем инлайн-подсказки для команд
-	if command == "" {
-		text := msg.Text
-		if strings.HasPrefix(text, "/") {
-			// Показываем подсказки для команд
-			commands := []string{
-				"/all - упомянуть всех пользователей в чате",
-				"/everyone - упомянуть всех пользователей в чате",
-				"/group - упомянуть пользователей определенной группы",
-				"/help - показать справку",
-				"/start - показать админ-панель",
-				"/admin - показать админ-панель",
-				"/add_user - добавить пользователя",
-				"/del_user - удалить пользователя",
-				"/list_users - показать список пользователей",
-				"/add_chat - добавить чат",
-				"/del_chat - удалить чат",
-				"/list_chats - показать список чатов",
-				"/add_group - создать группу",
-				"/del_group - удалить группу",
-				"/list_groups - показать список групп",
-				"/add_to_chat - добавить пользователя в чат",
-				"/add_to_group - добавить пользователя в группу",
-				"/link_group_chat - связать группу с чатом",
-				"/add_users_to_chat - добавить несколько пользователей в чат",
-			}
-
-			var suggestions []string
-			partial := strings.ToLower(text[1:]) // Убираем "/" и приводим к нижнему регистру
-
-			// Определяем тип команды и показываем соответствующие подсказки
-			switch {
-			case strings.HasPrefix(partial, "add_to_chat"):
-				chats := b.db.ListChats()
-				for _, chat := range chats {
-					suggestions = append(suggestions, fmt.Sprintf("/add_to_chat %d", chat.ChatID))
-				}
-			case strings.HasPrefix(partial, "add_to_group"):
-				groups := b.db.ListGroups()
-				for _, group := range groups {
-					suggestions = append(suggestions, fmt.Sprintf("/add_to_group %s", group.Name))
-				}
-			case strings.HasPrefix(partial, "del_user"):
-				users := b.db.ListUsers()
-				for _, user := range users {
-					suggestions = append(suggestions, fmt.Sprintf("/del_user %d", user.UserID))
-				}
-			case strings.HasPrefix(partial, "del_chat"):
-				chats := b.db.ListChats()
-				for _, chat := range chats {
-					suggestions = append(suggestions, fmt.Sprintf("/del_chat %d", chat.ChatID))
-				}
-			case strings.HasPrefix(partial, "del_group"):
-				groups := b.db.ListGroups()
-				for _, group := range groups {
-					suggestions = append(suggestions, fmt.Sprintf("/del_group %s", group.Name))
-				}
-			case strings.HasPrefix(partial, "link_group_chat"):
-				groups := b.db.ListGroups()
-				chats := b.db.ListChats()
-				for _, group := range groups {
-					for _, chat := range chats {
-						suggestions = append(suggestions, fmt.Sprintf("/link_group_chat %s %d", group.Name, chat.ChatID))
-					}
-				}
-			case strings.HasPrefix(partial, "add_users_to_chat"):
-				chats := b.db.ListChats()
-				for _, chat := range chats {
-					suggestions = append(suggestions, fmt.Sprintf("/add_users_to_chat %d", chat.ChatID))
-				}
-			default:
-				for _, cmd := range commands {
-					if strings.HasPrefix(strings.ToLower(cmd), partial) {
-						suggestions = append(suggestions, cmd)
-					}
-				}
-			}
-
-			if len(suggestions) > 0 {
-				msg := tgbotapi.NewMessage(chatID, "Возможно, вы имели в виду:\n\n"+strings.Join(suggestions, "\n"))
-				b.bot.Send(msg)
-				return
-			}
-		}
+// groupMentionError возвращает текст ошибки, если группу нельзя упомянуть в чате
+func (b *TelegramBot) groupMentionError(ctx context.Context, chatID int64, groupName string) string {
+	found, err := b.db.GroupExists(ctx, groupName)
+	if err != nil {
+		log.Printf("Ошибка проверки группы %s: %v", groupName, err)
+		return dbErrorText
+	}
+	if !found {
+		return fmt.Sprintf("Группа %s не найдена.", groupName)
+	}
+	linked, err := b.db.GroupLinkedToChat(ctx, groupName, chatID)
+	if err != nil {
+		log.Printf("Ошибка проверки привязки группы %s к чату %d: %v", groupName, chatID, err)
+		return dbErrorText
+	}
+	if !linked {
+		return fmt.Sprintf("Группа %s не привязана к этому чату. Администратор может привязать ее командой /link_group_chat %s %d", groupName, groupName, chatID)
 	}
+	return ""
+}
 
-	switch command {
-	case "start":
-		if b.IsAdmin(userID) {
-			b.ShowAdminPanel(chatID)
-		} else {
-			msg := tgbotapi.NewMessage(chatID, "У вас нет доступа к этой функции.")
-			b.bot.Send(msg)
-		}
+func (b *TelegramBot) HandleCallbackQuery(ctx context.Context, update tgbotapi.Update) {
+	query := update.CallbackQuery
+	adminchatID := query.Message.Chat.ID
+	userID := query.From.ID
 
-	case "help":
-		b.ShowHelp(chatID)
+	// Telegram показывает индикатор загрузки, пока на callback не ответили,
+	// поэтому отвечаем всегда - при необходимости с уведомлением
+	var notice callbackNotice
+	defer func() { b.answerCallback(query.ID, notice) }()
 
-	case "all", "everyone":
-		users := b.db.GetUsersForMention(chatID, "")
-		if len(users) > 0 {
-			msg := tgbotapi.NewMessage(chatID, strings.Join(users, " "))
-			b.bot.Send(msg)
-		} else {
-			msg := tgbotapi.NewMessage(chatID, "В этом чате пока нет пользователей.")
-			b.bot.Send(msg)
-		}
-
-	case "group":
-		args := strings.Fields(msg.Text)
-		if len(args) < 2 {
-			msg := tgbotapi.NewMessage(chatID, "Использование: /group <название_группы>")
-			b.bot.Send(msg)
-			return
-		}
-		groupName := args[1]
-		users := b.db.GetUsersForMention(chatID, groupName)
-		if len(users) > 0 {
-			msg := tgbotapi.NewMessage(chatID, strings.Join(users, " "))
-			b.bot.Send(msg)
-		} else {
-			msg := tgbotapi.NewMessage(chatID, "В этой группе пока нет пользователей.")
-			b.bot.Send(msg)
-		}
-
-	case "add_user":
-		if !b.IsAdmin(userID) {
-			msg := tgbotapi.NewMessage(chatID, "У вас нет доступа к этой функции.")
-			b.bot.Send(msg)
-			return
-		}
-		args := strings.Fields(msg.Text)
-		if len(args) != 3 {
-			msg := tgbotapi.NewMessage(chatID, "Использование: /add_user <user_id> <username>")
-			b.bot.Send(msg)
-			return
-		}
-		userID, err := strconv.ParseInt(args[1], 10, 64)
-		if err != nil {
-			msg := tgbotapi.NewMessage(chatID, "Неверный формат user_id")
-			b.bot.Send(msg)
-			return
-		}
-		if err := b.db.AddUser(userID, args[2]); err != nil {
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка добавления пользователя: %v", err))
-			b.bot.Send(msg)
-			return
-		}
-		msg := tgbotapi.NewMessage(chatID, "Пользователь успешно добавлен")
-		b.bot.Send(msg)
-
-	case "add_chat":
-		if !b.IsAdmin(userID) {
-			msg := tgbotapi.NewMessage(chatID, "У вас нет доступа к этой функции.")
-			b.bot.Send(msg)
-			return
-		}
-		args := strings.Fields(msg.Text)
-		if len(args) != 3 {
-			msg := tgbotapi.NewMessage(chatID, "Использование: /add_chat <chat_id> <title>")
-			b.bot.Send(msg)
-			return
-		}
-		chatID, err := strconv.ParseInt(args[1], 10, 64)
-		if err != nil {
-			msg := tgbotapi.NewMessage(chatID, "Неверный формат chat_id")
-			b.bot.Send(msg)
-			return
-		}
-		if err := b.db.AddChat(chatID, args[2]); err != nil {
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка добавления чата: %v", err))
-			b.bot.Send(msg)
-			return
-		}
-		msg := tgbotapi.NewMessage(chatID, "Чат успешно добавлен")
-		b.bot.Send(msg)
-
-	case "add_group":
-		if !b.IsAdmin(userID) {
-			msg := tgbotapi.NewMessage(chatID, "У вас нет доступа к этой функции.")
-			b.bot.Send(msg)
-			return
-		}
-		args := strings.Fields(msg.Text)
-		if len(args) != 2 {
-			msg := tgbotapi.NewMessage(chatID, "Использование: /add_group <name>")
-			b.bot.Send(msg)
-			return
-		}
-		if err := b.db.AddGroup(args[1]); err != nil {
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка добавления группы: %v", err))
-			b.bot.Send(msg)
-			return
-		}
-		msg := tgbotapi.NewMessage(chatID, "Группа успешно добавлена")
-		b.bot.Send(msg)
-		b.ShowAdminPanel(chatID)
-
-	case "add_users_to_chat":
-		if !b.IsAdmin(userID) {
-			msg := tgbotapi.NewMessage(chatID, "У вас нет доступа к этой функции.")
-			b.bot.Send(msg)
-			return
-		}
-		args := strings.Fields(msg.Text)
-		if len(args) < 3 {
-			msg := tgbotapi.NewMessage(chatID, "Использование: /add_users_to_chat <chat_id> <user_id1> [user_id2 ...]")
-			b.bot.Send(msg)
-			return
-		}
-		chatID, err := strconv.ParseInt(args[1], 10, 64)
+	cb, err := decodeCallback(query.Data)
+	if err != nil {
+		log.Printf("Ошибка разбора callback %q: %v", query.Data, err)
+		notice = alert("Кнопка устарела. Откройте меню заново командой /admin.")
+		return
+	}
+	if cb.hasGroup() {
+		group, found, err := b.db.GetGroupByID(ctx, cb.GroupID)
 		if err != nil {
-			msg := tgbotapi.NewMessage(chatID, "Неверный формат chat_id")
-			b.bot.Send(msg)
+			log.Printf("Ошибка получения группы %d: %v", cb.GroupID, err)
+			notice = alert(dbErrorText)
 			return
 		}
-		var userIDs []int64
-		for _, arg := range args[2:] {
-			userID, err := strconv.ParseInt(arg, 10, 64)
-			if err != nil {
-				msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Неверный формат user_id: %s", arg))
-				b.bot.Send(msg)
-				return
-			}
-			userIDs = append(userIDs, userID)
-		}
-		if err := b.db.AddUsersToChat(userIDs, chatID); err != nil {
-			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка добавления пользователей в чат: %v", err))
-			b.bot.Send(msg)
+		if !found {
+			notice = alert("Группа не найдена. Откройте меню заново командой /admin.")
 			return
 		}
-		msg := tgbotapi.NewMessage(chatID, "Пользователи успешно добавлены в чат")
-		b.bot.Send(msg)
-
-	default:
-		msg := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /help для просмотра доступных команд.")
-		b.bot.Send(msg)
+		cb.Group = group.Name
 	}
-}
-
-func (b *TelegramBot) HandleCallbackQuery(update tgbotapi.Update) {
-	query := update.CallbackQuery.Data
-	adminchatID := update.CallbackQuery.Message.Chat.ID
-	userID := update.CallbackQuery.From.ID
 
-	if !b.IsAdmin(userID) {
-		msg := tgbotapi.NewMessage(adminchatID, "У вас нет доступа к этой функции.")
-		b.bot.Send(msg)
+	if !b.HasPermission(ctx, userID, b.callbackScope(ctx, cb, adminchatID), cb.permission()) {
+		notice = alert("У вас нет доступа к этой функции.")
 		return
 	}
 
-	// Удаляем предыдущее сообщение
-	b.deleteMessage(adminchatID, update.CallbackQuery.Message.MessageID)
-
-	switch {
-	case query == "all":
-		// Получаем все чаты пользователя
-		chats := b.db.GetChatsForUser(userID)
-		if len(chats) > 0 {
-			// Используем первый чат из списка
-			users := b.db.GetUsersForMention(chats[0].ChatID, "")
-			if len(users) > 0 {
-				msg := tgbotapi.NewMessage(adminchatID, strings.Join(users, " "))
-				b.bot.Send(msg)
-			} else {
-				msg := tgbotapi.NewMessage(adminchatID, "В этом чате пока нет пользователей.")
-				b.bot.Send(msg)
-			}
-		} else {
-			msg := tgbotapi.NewMessage(adminchatID, "У вас пока нет доступных чатов.")
-			b.bot.Send(msg)
+	switch cb.Action {
+	case actCreateUser, actCreateChat, actCreateGroup:
+		flows := map[callbackAction]string{
+			actCreateUser:  "create_user",
+			actCreateChat:  "create_chat",
+			actCreateGroup: "create_group",
 		}
-
-	case strings.HasPrefix(query, "group "):
-		groupName := strings.TrimPrefix(query, "group ")
-		// Получаем все чаты пользователя
-		chats := b.db.GetChatsForUser(userID)
-		if len(chats) > 0 {
-			// Используем первый чат из списка
-			users := b.db.GetUsersForMention(chats[0].ChatID, groupName)
-			if len(users) > 0 {
-				msg := tgbotapi.NewMessage(adminchatID, strings.Join(users, " "))
-				b.bot.Send(msg)
-			} else {
-				msg := tgbotapi.NewMessage(adminchatID, "В этой группе пока нет пользователей.")
-				b.bot.Send(msg)
-			}
-		} else {
-			msg := tgbotapi.NewMessage(adminchatID, "У вас пока нет доступных чатов.")
-			b.bot.Send(msg)
+		if err := b.startConversation(ctx, userID, adminchatID, flows[cb.Action], nil, &update); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка начала ввода: %v", err))
 		}
 
-	case strings.HasPrefix(query, "create_user"):
-		msg := tgbotapi.NewMessage(adminchatID, "Введите данные пользователя в формате:\n/add_user <user_id> <username>")
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_users"),
-			),
-		)
-		b.bot.Send(msg)
-
-	case strings.HasPrefix(query, "create_chat"):
-		msg := tgbotapi.NewMessage(adminchatID, "Введите данные чата в формате:\n/add_chat <chat_id> <title>")
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_chats"),
-			),
-		)
-		b.bot.Send(msg)
+	case actConvBack, actConvCancel, actConvSkip, actConvConfirm:
+		notice = b.handleConversationCallback(ctx, cb, &update)
 
-	case strings.HasPrefix(query, "create_group"):
-		msg := tgbotapi.NewMessage(adminchatID, "Введите название группы в формате:\n/add_group <name>")
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_groups"),
-			),
-		)
-		b.bot.Send(msg)
+	case actUsers:
+		b.ShowUsersList(ctx, adminchatID, cb.Page, &update)
 
-	case strings.HasPrefix(query, "users_page_"):
-		page, _ := strconv.Atoi(strings.TrimPrefix(query, "users_page_"))
-		b.ShowUsersList(adminchatID, page, &update)
+	case actChats:
+		b.ShowChatsList(ctx, adminchatID, cb.Page, &update)
 
-	case strings.HasPrefix(query, "chats_page_"):
-		page, _ := strconv.Atoi(strings.TrimPrefix(query, "chats_page_"))
-		b.ShowChatsList(adminchatID, page, &update)
+	case actGroups:
+		b.ShowGroupsList(ctx, adminchatID, cb.Page, &update)
 
-	case strings.HasPrefix(query, "groups_page_"):
-		page, _ := strconv.Atoi(strings.TrimPrefix(query, "groups_page_"))
-		b.ShowGroupsList(adminchatID, page, &update)
+	case actUserInfo:
+		b.ShowUserInfo(ctx, adminchatID, cb.UserID, &update)
 
-	case strings.HasPrefix(query, "user_info_"):
-		userID, _ := strconv.ParseInt(strings.TrimPrefix(query, "user_info_"), 10, 64)
-		b.ShowUserInfo(adminchatID, userID)
+	case actChatInfo:
+		b.ShowChatInfo(ctx, adminchatID, cb.ChatID, &update)
 
-	case strings.HasPrefix(query, "chat_info_"):
-		OtherChatid, _ := strconv.ParseInt(strings.TrimPrefix(query, "chat_info_"), 10, 64)
-		b.ShowChatInfo(adminchatID, OtherChatid)
+	case actGroupInfo:
+		b.ShowGroupInfo(ctx, adminchatID, cb.GroupID, &update)
 
-	case strings.HasPrefix(query, "group_info_"):
-		groupName := strings.TrimPrefix(query, "group_info_")
-		b.ShowGroupInfo(adminchatID, groupName)
+	case actEditUser:
+		b.ShowUserEdit(ctx, adminchatID, cb.UserID, &update)
 
-	case strings.HasPrefix(query, "edit_user_"):
-		userID, _ := strconv.ParseInt(strings.TrimPrefix(query, "edit_user_"), 10, 64)
-		// TODO: Реализовать редактирование пользователя
-		msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Редактирование пользователя %d (в разработке)", userID))
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_users"),
-			),
-		)
-		b.bot.Send(msg)
+	case actRenameUser:
+		data := map[string]string{"user_id": strconv.FormatInt(cb.UserID, 10)}
+		if err := b.startConversation(ctx, userID, adminchatID, "rename_user", data, &update); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка начала ввода: %v", err))
+		}
 
-	case strings.HasPrefix(query, "delete_user_"):
-		userID, _ := strconv.ParseInt(strings.TrimPrefix(query, "delete_user_"), 10, 64)
-		if err := b.db.DeleteUser(userID); err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, "Ошибка удаления пользователя")
-			b.bot.Send(msg)
+	case actUserLeaveChat:
+		if err := b.db.RemoveUserFromChat(ctx, cb.UserID, cb.ChatID); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка удаления пользователя из чата: %v", err))
 			return
 		}
-		msg := tgbotapi.NewMessage(adminchatID, "Пользователь успешно удален")
-		b.bot.Send(msg)
-		b.ShowAdminPanel(adminchatID)
-
-	case strings.HasPrefix(query, "edit_chat_"):
-		//chatID, _ := strconv.ParseInt(strings.TrimPrefix(query, "edit_chat_"), 10, 64)
-		// TODO: Реализовать редактирование чата
-		msg := tgbotapi.NewMessage(adminchatID, "Редактирование чата (в разработке)")
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_chats"),
-			),
-		)
-		b.bot.Send(msg)
+		notice = toast("Пользователь удален из чата")
+		b.ShowUserEdit(ctx, adminchatID, cb.UserID, &update)
 
-	case strings.HasPrefix(query, "delete_chat_"):
-		chatID, _ := strconv.ParseInt(strings.TrimPrefix(query, "delete_chat_"), 10, 64)
-		if err := b.db.DeleteChat(chatID); err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, "Ошибка удаления чата")
-			b.bot.Send(msg)
+	case actUserLeaveGroup:
+		if err := b.db.RemoveUserFromGroup(ctx, cb.UserID, cb.Group); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка удаления пользователя из группы: %v", err))
 			return
 		}
-		msg := tgbotapi.NewMessage(adminchatID, "Чат успешно удален")
-		b.bot.Send(msg)
-		b.ShowAdminPanel(adminchatID)
-
-	case strings.HasPrefix(query, "edit_group_"):
-		groupName := strings.TrimPrefix(query, "edit_group_")
-		// TODO: Реализовать редактирование группы
-		msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Редактирование группы %s (в разработке)", groupName))
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Назад", "admin_groups"),
-			),
-		)
-		b.bot.Send(msg)
+		notice = toast("Пользователь удален из группы")
+		b.ShowUserEdit(ctx, adminchatID, cb.UserID, &update)
 
-	case strings.HasPrefix(query, "delete_group_"):
-		groupName := strings.TrimPrefix(query, "delete_group_")
-		if err := b.db.DeleteGroup(groupName); err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, "Ошибка удаления группы")
-			b.bot.Send(msg)
+	case actDeleteUser:
+		if err := b.db.DeleteUser(ctx, cb.UserID); err != nil {
+			notice = alert("Ошибка удаления пользователя")
 			return
 		}
-		msg := tgbotapi.NewMessage(adminchatID, "Группа успешно удалена")
-		b.bot.Send(msg)
-		b.ShowAdminPanel(adminchatID)
+		notice = toast("Пользователь успешно удален")
+		b.ShowUsersList(ctx, adminchatID, 1, &update)
 
-	case query == "admin_users":
-		b.ShowUsersList(adminchatID, 1, &update)
+	case actEditChat:
+		b.ShowChatEdit(ctx, adminchatID, cb.ChatID, &update)
 
-	case query == "admin_chats":
-		b.ShowChatsList(adminchatID, 1, &update)
+	case actRenameChat:
+		data := map[string]string{"chat_id": strconv.FormatInt(cb.ChatID, 10)}
+		if err := b.startConversation(ctx, userID, adminchatID, "rename_chat", data, &update); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка начала ввода: %v", err))
+		}
 
-	case query == "admin_groups":
-		b.ShowGroupsList(adminchatID, 1, &update)
+	case actDeleteChat:
+		if err := b.db.DeleteChat(ctx, cb.ChatID); err != nil {
+			notice = alert("Ошибка удаления чата")
+			return
+		}
+		notice = toast("Чат успешно удален")
+		b.ShowChatsList(ctx, adminchatID, 1, &update)
 
-	case query == "admin_relations":
-		b.ShowRelations(adminchatID)
+	case actEditGroup:
+		b.ShowGroupEdit(ctx, adminchatID, cb.GroupID, &update)
 
-	case query == "admin_view":
-		b.ShowViewMenu(adminchatID)
+	case actRenameGroup:
+		data := map[string]string{"group": cb.Group, "group_id": strconv.FormatUint(uint64(cb.GroupID), 10)}
+		if err := b.startConversation(ctx, userID, adminchatID, "rename_group", data, &update); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка начала ввода: %v", err))
+		}
 
-	case query == "admin_back":
-		b.ShowAdminPanel(adminchatID)
+	case actDeleteGroup:
+		if err := b.db.DeleteGroup(ctx, cb.Group); err != nil {
+			notice = alert("Ошибка удаления группы")
+			return
+		}
+		notice = toast("Группа успешно удалена")
+		b.ShowGroupsList(ctx, adminchatID, 1, &update)
 
-	case strings.HasPrefix(query, "add_users_to_chat_"):
-		chatID, _ := strconv.ParseInt(strings.TrimPrefix(query, "add_users_to_chat_"), 10, 64)
-		b.ShowUsersToAddToChat(adminchatID, chatID, 1, &update)
+	case actRelations:
+		b.ShowRelations(ctx, adminchatID, &update)
 
-	case strings.HasPrefix(query, "add_users_to_chat_page_"):
-		parts := strings.Split(strings.TrimPrefix(query, "add_users_to_chat_page_"), "_")
-		chatID, _ := strconv.ParseInt(parts[0], 10, 64)
-		page, _ := strconv.Atoi(parts[1])
-		b.ShowUsersToAddToChat(adminchatID, chatID, page, &update)
+	case actViewMenu:
+		b.ShowViewMenu(adminchatID, &update)
 
-	case strings.HasPrefix(query, "add_user_to_chat_"):
-		parts := strings.Split(strings.TrimPrefix(query, "add_user_to_chat_"), "_")
-		chatID, _ := strconv.ParseInt(parts[0], 10, 64)
-		userID, _ := strconv.ParseInt(parts[1], 10, 64)
+	case actAdminPanel:
+		b.ShowAdminPanel(adminchatID, &update)
 
-		if err := b.db.AddUserToChat(userID, chatID); err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Ошибка добавления пользователя в чат: %v", err))
-			b.bot.Send(msg)
+	case actUsersToChat:
+		b.ShowUsersToAddToChat(ctx, adminchatID, cb.ChatID, cb.Page, &update)
+
+	case actAddUserToChat:
+		if err := b.db.AddUserToChat(ctx, cb.UserID, cb.ChatID); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка добавления пользователя в чат: %v", err))
 			return
 		}
+		notice = toast("Пользователь успешно добавлен в чат")
+		if user, err := b.db.GetUser(ctx, cb.UserID); err == nil {
+			notice = toast(fmt.Sprintf("Пользователь %s успешно добавлен в чат", userLabel(*user)))
+		}
+		// Остаемся в списке, чтобы можно было добавить следующих пользователей
+		b.ShowUsersToAddToChat(ctx, adminchatID, cb.ChatID, cb.Page, &update)
 
-		// Получаем информацию о пользователе для сообщения
-		user, err := b.db.GetUser(userID)
-		if err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, "Пользователь успешно добавлен в чат")
-			b.bot.Send(msg)
+	case actChatRemoveUser:
+		if err := b.db.RemoveUserFromChat(ctx, cb.UserID, cb.ChatID); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка удаления пользователя из чата: %v", err))
 			return
 		}
+		notice = toast("Пользователь удален из чата")
+		b.ShowChatInfo(ctx, adminchatID, cb.ChatID, &update)
 
-		msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Пользователь @%s успешно добавлен в чат", user.Username))
-		b.bot.Send(msg)
-		b.ShowAdminPanel(adminchatID)
-
-	case strings.HasPrefix(query, "add_users_to_group_"):
-		groupName := strings.TrimPrefix(query, "add_users_to_group_")
-		b.ShowUsersToAddToGroup(adminchatID, groupName, 1, &update)
-
-	case strings.HasPrefix(query, "add_users_to_group_page_"):
-		parts := strings.Split(strings.TrimPrefix(query, "add_users_to_group_page_"), "_")
-		groupName := parts[0]
-		page, _ := strconv.Atoi(parts[1])
-		b.ShowUsersToAddToGroup(adminchatID, groupName, page, &update)
+	case actChatUnlinkGroup:
+		if err := b.db.UnlinkGroupFromChat(ctx, cb.Group, cb.ChatID); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка отвязки группы от чата: %v", err))
+			return
+		}
+		notice = toast("Группа отвязана от чата")
+		b.ShowChatInfo(ctx, adminchatID, cb.ChatID, &update)
 
-	case strings.HasPrefix(query, "add_user_to_group_"):
-		parts := strings.Split(strings.TrimPrefix(query, "add_user_to_group_"), "_")
-		groupName := parts[0]
-		userID, _ := strconv.ParseInt(parts[1], 10, 64)
+	case actGroupRemoveUser:
+		if err := b.db.RemoveUserFromGroup(ctx, cb.UserID, cb.Group); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка удаления пользователя из группы: %v", err))
+			return
+		}
+		notice = toast("Пользователь удален из группы")
+		b.ShowGroupInfo(ctx, adminchatID, cb.GroupID, &update)
 
-		if err := b.db.AddUsersToGroup([]int64{userID}, groupName); err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Ошибка добавления пользователя в группу: %v", err))
-			b.bot.Send(msg)
+	case actGroupUnlinkChat:
+		if err := b.db.UnlinkGroupFromChat(ctx, cb.Group, cb.ChatID); err != nil {
+			notice = alert(fmt.Sprintf("Ошибка отвязки группы от чата: %v", err))
 			return
 		}
+		notice = toast("Группа отвязана от чата")
+		b.ShowGroupInfo(ctx, adminchatID, cb.GroupID, &update)
+
+	case actUsersToGroup:
+		b.ShowUsersToAddToGroup(ctx, adminchatID, cb.GroupID, cb.Page, &update)
 
-		// Получаем информацию о пользователе для сообщения
-		user, err := b.db.GetUser(userID)
+	case actAddUserToGroup:
+		result, err := b.db.AddUsersToGroup(ctx, []int64{cb.UserID}, cb.Group)
 		if err != nil {
-			msg := tgbotapi.NewMessage(adminchatID, "Пользователь успешно добавлен в группу")
-			b.bot.Send(msg)
+			notice = alert(fmt.Sprintf("Ошибка добавления пользователя в группу: %v", err))
 			return
 		}
-
-		msg := tgbotapi.NewMessage(adminchatID, fmt.Sprintf("Пользователь @%s успешно добавлен в группу", user.Username))
-		b.bot.Send(msg)
-		b.ShowAdminPanel(adminchatID)
+		if len(result.Unknown) > 0 {
+			notice = alert(fmt.Sprintf("Пользователь не найден: %d", cb.UserID))
+			return
+		}
+		notice = toast("Пользователь успешно добавлен в группу")
+		if user, err := b.db.GetUser(ctx, cb.UserID); err == nil {
+			notice = toast(fmt.Sprintf("Пользователь %s успешно добавлен в группу", userLabel(*user)))
+		}
+		b.ShowUsersToAddToGroup(ctx, adminchatID, cb.GroupID, cb.Page, &update)
 
 	default:
-		msg := tgbotapi.NewMessage(adminchatID, "Неизвестное действие.")
-		b.bot.Send(msg)
+		notice = alert("Неизвестное действие.")
 	}
 }
 
-func (b *TelegramBot) HandleInlineQuery(update tgbotapi.Update) {
+func (b *TelegramBot) HandleInlineQuery(ctx context.Context, update tgbotapi.Update) {
 	query := update.InlineQuery
 	if query == nil {
 		return
@@ -1150,17 +1048,25 @@ func (b *TelegramBot) HandleInlineQuery(update tgbotapi.Update) {
 
 	// Показываем список групп для пользователя
 	var results []interface{}
-	
+
 	// Получаем группы для пользователя
-	userGroups := b.db.GetGroupsForUser(query.From.ID)
-	
+	userGroups, err := b.db.GetGroupsForUser(ctx, query.From.ID)
+	if err != nil {
+		log.Printf("Ошибка получения групп пользователя %d: %v", query.From.ID, err)
+		return
+	}
+
 	// Получаем текущий чат пользователя
-	chats := b.db.GetChatsForUser(query.From.ID)
+	chats, err := b.db.GetChatsForUser(ctx, query.From.ID)
+	if err != nil {
+		log.Printf("Ошибка получения чатов пользователя %d: %v", query.From.ID, err)
+		return
+	}
 	var currentChatID int64
 	if len(chats) > 0 {
 		currentChatID = chats[0].ChatID
 	}
-	
+
 	if len(userGroups) > 0 {
 		for _, group := range userGroups {
 			groupButton := tgbotapi.NewInlineQueryResultArticle(
@@ -1168,23 +1074,32 @@ func (b *TelegramBot) HandleInlineQuery(update tgbotapi.Update) {
 				fmt.Sprintf("Группа: %s", group.Name),
 				fmt.Sprintf("Упомянуть пользователей группы %s", group.Name),
 			)
-			
+
 			// Получаем список пользователей группы
 			var groupMentionText string
+			var groupMentionEntities []tgbotapi.MessageEntity
 			if currentChatID != 0 {
-				groupUsers := b.db.GetUsersForMention(currentChatID, group.Name)
-				if len(groupUsers) > 0 {
-					groupMentionText = strings.Join(groupUsers, " ")
+				groupUsers, err := b.db.GetUsersForMention(ctx, currentChatID, group.Name)
+				if errText := b.groupMentionError(ctx, currentChatID, group.Name); errText != "" {
+					groupMentionText = errText
+				} else if err != nil {
+					log.Printf("Ошибка получения пользователей для упоминания: %v", err)
+					groupMentionText = dbErrorText
+				} else if len(groupUsers) > 0 {
+					// Инлайн-результат - это одно сообщение, поэтому берем только первую пачку
+					batches := splitMentions(groupUsers, maxMessageLength, maxMentionsPerMessage)
+					groupMentionText, groupMentionEntities = buildMentions(batches[0])
 				} else {
 					groupMentionText = fmt.Sprintf("В группе %s нет пользователей в текущем чате.", group.Name)
 				}
 			} else {
 				groupMentionText = fmt.Sprintf("Не удалось определить текущий чат. Используйте команду /group %s в нужном чате.", group.Name)
 			}
-			
+
 			groupButton.Description = fmt.Sprintf("Отметить участников группы %s в чате", group.Name)
 			groupButton.InputMessageContent = tgbotapi.InputTextMessageContent{
-				Text: groupMentionText,
+				Text:     groupMentionText,
+				Entities: groupMentionEntities,
 			}
 			results = append(results, groupButton)
 		}
@@ -1201,7 +1116,7 @@ func (b *TelegramBot) HandleInlineQuery(update tgbotapi.Update) {
 		}
 		results = append(results, noGroups)
 	}
-	
+
 	// Добавляем информационную кнопку про упоминание всех пользователей
 	infoButton := tgbotapi.NewInlineQueryResultArticle(
 		query.ID+"_info",
@@ -1214,7 +1129,7 @@ func (b *TelegramBot) HandleInlineQuery(update tgbotapi.Update) {
 	}
 	infoButton.ThumbURL = "https://img.icons8.com/color/48/000000/info.png"
 	results = append(results, infoButton)
-	
+
 	// Отправляем результаты
 	inlineConfig := tgbotapi.InlineConfig{
 		InlineQueryID: query.ID,
@@ -0,0 +1,566 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ID пользователей положительные, ID групповых чатов, как и в Telegram, отрицательные
+// и не совпадают с ID пользователей, чтобы проверки прав не проходили случайно
+const (
+	testAdminID  int64 = 100
+	testUserID   int64 = 200
+	testChatID   int64 = -100
+	testTargetID int64 = -300
+)
+
+// testCtx - контекст без ограничения времени для вызовов бота и базы в тестах
+var testCtx = context.Background()
+
+// fakeAPI запоминает отправленные ботом сообщения вместо обращения к Telegram
+type fakeAPI struct {
+	sent []tgbotapi.Chattable
+	// editErr возвращается при попытке отредактировать сообщение
+	editErr error
+	// admins - администраторы групповых чатов в Telegram
+	admins []int64
+	// requestErr, если задан, возвращает ошибку для запроса к Telegram
+	requestErr func(c tgbotapi.Chattable) error
+}
+
+func (f *fakeAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.sent = append(f.sent, c)
+	return tgbotapi.Message{}, nil
+}
+
+func (f *fakeAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if f.requestErr != nil {
+		if err := f.requestErr(c); err != nil {
+			return nil, err
+		}
+	}
+	f.sent = append(f.sent, c)
+	if _, ok := c.(tgbotapi.EditMessageTextConfig); ok && f.editErr != nil {
+		return nil, f.editErr
+	}
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeAPI) GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	return make(chan tgbotapi.Update)
+}
+
+func (f *fakeAPI) GetChatAdministrators(config tgbotapi.ChatAdministratorsConfig) ([]tgbotapi.ChatMember, error) {
+	var members []tgbotapi.ChatMember
+	for _, id := range f.admins {
+		members = append(members, tgbotapi.ChatMember{User: &tgbotapi.User{ID: id}, Status: "administrator"})
+	}
+	return members, nil
+}
+
+// texts возвращает тексты отправленных сообщений
+func (f *fakeAPI) texts() []string {
+	var texts []string
+	for _, c := range f.sent {
+		if msg, ok := c.(tgbotapi.MessageConfig); ok {
+			texts = append(texts, msg.Text)
+		}
+	}
+	return texts
+}
+
+func newTestBot() (*TelegramBot, *fakeAPI, *fakeDB) {
+	api := &fakeAPI{}
+	db := newFakeDB()
+	b := &TelegramBot{
+		bot:        api,
+		db:         db,
+		adminID:    testAdminID,
+		cooldowns:  make(map[string]Cooldown),
+		chatAdmins: newChatAdminsCache(chatAdminsTTL),
+	}
+	b.commands = newCommandRegistry(b.newCommands())
+	b.flows = b.newFlows()
+	return b, api, db
+}
+
+// commandUpdate создает обновление с командой в групповом чате testChatID
+func commandUpdate(userID int64, text string) tgbotapi.Update {
+	command := strings.Fields(text)[0]
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+			Chat: &tgbotapi.Chat{ID: testChatID, Type: "group"},
+			Text: text,
+			Entities: []tgbotapi.MessageEntity{
+				{Type: "bot_command", Offset: 0, Length: len(command)},
+			},
+		},
+	}
+}
+
+func lastText(t *testing.T, api *fakeAPI) string {
+	t.Helper()
+	texts := api.texts()
+	if len(texts) == 0 {
+		t.Fatal("бот не отправил ни одного сообщения")
+	}
+	return texts[len(texts)-1]
+}
+
+func TestAdminCommandsUsage(t *testing.T) {
+	commands := []string{
+		"/del_user",
+		"/del_user 1 2",
+		"/del_chat",
+		"/del_group",
+		"/add_to_chat 1",
+		"/add_to_group 1",
+		"/link_group_chat",
+	}
+	for _, command := range commands {
+		t.Run(command, func(t *testing.T) {
+			b, api, _ := newTestBot()
+			b.HandleCommand(testCtx, commandUpdate(testAdminID, command))
+			if text := lastText(t, api); !strings.HasPrefix(text, "Использование:") {
+				t.Errorf("ожидалось сообщение об использовании, получено %q", text)
+			}
+		})
+	}
+}
+
+func TestAdminCommandsInvalidID(t *testing.T) {
+	cases := map[string]string{
+		"/del_user abc":          "Неверный формат user_id",
+		"/del_chat abc":          "Неверный формат chat_id",
+		"/add_to_chat abc 1":     "Неверный формат user_id",
+		"/add_to_chat 1 abc":     "Неверный формат chat_id",
+		"/add_to_group abc team": "Неверный формат user_id",
+		"/link_group_chat a b":   "Неверный формат chat_id",
+	}
+	for command, want := range cases {
+		t.Run(command, func(t *testing.T) {
+			b, api, _ := newTestBot()
+			b.HandleCommand(testCtx, commandUpdate(testAdminID, command))
+			if text := lastText(t, api); text != want {
+				t.Errorf("получено %q, ожидалось %q", text, want)
+			}
+		})
+	}
+}
+
+func TestAdminCommandsRequirePermission(t *testing.T) {
+	commands := []string{
+		"/admin",
+		"/del_user 1",
+		"/list_users",
+		"/del_chat 1",
+		"/list_chats",
+		"/del_group team",
+		"/list_groups",
+		"/add_to_chat 1 -300",
+		"/add_to_group 1 team",
+		"/link_group_chat team -300",
+	}
+	for _, command := range commands {
+		t.Run(command, func(t *testing.T) {
+			b, api, _ := newTestBot()
+			b.HandleCommand(testCtx, commandUpdate(testUserID, command))
+			if text := lastText(t, api); text != "У вас нет доступа к этой функции." {
+				t.Errorf("ожидался отказ в доступе, получено %q", text)
+			}
+		})
+	}
+}
+
+func TestDelUser(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_user 200"))
+	if text := lastText(t, api); text != "Пользователь успешно удален" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if db.hasUser(testUserID) {
+		t.Error("пользователь не удален")
+	}
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_user 200"))
+	if text := lastText(t, api); text != "Пользователь не найден: 200" {
+		t.Errorf("неожиданный ответ для удаленного пользователя: %q", text)
+	}
+}
+
+func TestDelChat(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddChat(testCtx, testTargetID, "team")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_chat -300"))
+	if text := lastText(t, api); text != "Чат успешно удален" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if db.hasChat(testTargetID) {
+		t.Error("чат не удален")
+	}
+}
+
+func TestDelGroup(t *testing.T) {
+	b, api, db := newTestBot()
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_group team"))
+	if text := lastText(t, api); text != "Группа не найдена: team" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+
+	db.AddGroup(testCtx, "team")
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_group team"))
+	if text := lastText(t, api); text != "Группа успешно удалена" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if db.hasGroup("team") {
+		t.Error("группа не удалена")
+	}
+}
+
+func TestAddToChat(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/add_to_chat 200 -300"))
+	if text := lastText(t, api); !strings.HasPrefix(text, "Ошибка добавления пользователя в чат") {
+		t.Fatalf("ожидалась ошибка для несуществующего чата, получено %q", text)
+	}
+
+	db.AddChat(testCtx, testTargetID, "team")
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/add_to_chat 200 -300"))
+	if text := lastText(t, api); text != "Пользователь успешно добавлен в чат" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if !db.inChat(testUserID, testTargetID) {
+		t.Error("связь пользователя с чатом не создана")
+	}
+}
+
+func TestAddToGroup(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddGroup(testCtx, "team")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/add_to_group 200 team"))
+	if text := lastText(t, api); text != "Пользователь успешно добавлен в группу" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if !db.inGroup(testUserID, "team") {
+		t.Error("пользователь не добавлен в группу")
+	}
+}
+
+func TestLinkGroupChat(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddGroup(testCtx, "team")
+	db.AddChat(testCtx, testTargetID, "team chat")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/link_group_chat team -300"))
+	if text := lastText(t, api); text != "Группа успешно привязана к чату" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if !db.linked("team", testTargetID) {
+		t.Error("группа не привязана к чату")
+	}
+}
+
+func TestAddUsersToChatReport(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddUser(testCtx, testUserID+1, "other", "", "")
+	db.AddChat(testCtx, testTargetID, "team chat")
+	db.AddUserToChat(testCtx, testUserID, testTargetID)
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/add_users_to_chat -300 200 201 999"))
+	want := "Добавление пользователей в чат завершено\n\nДобавлено: 1\nУже были добавлены: 200\nНе найдены: 999"
+	if text := lastText(t, api); text != want {
+		t.Errorf("неожиданный ответ: %q", text)
+	}
+	if !db.inChat(testUserID+1, testTargetID) {
+		t.Error("пользователь не добавлен в чат")
+	}
+}
+
+func TestMentionDistinguishesEmptyFromFailed(t *testing.T) {
+	b, api, db := newTestBot()
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/all"))
+	if text := lastText(t, api); text != "В этом чате пока нет пользователей." {
+		t.Errorf("неожиданный ответ для пустого чата: %q", text)
+	}
+
+	db.readErr = errors.New("database is locked")
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/all"))
+	if text := lastText(t, api); text != dbErrorText {
+		t.Errorf("неожиданный ответ при ошибке базы: %q", text)
+	}
+}
+
+func TestMentionReportsExpiredContext(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+	b.HandleCommand(ctx, commandUpdate(testAdminID, "/all"))
+	if text := lastText(t, api); text != dbErrorText {
+		t.Errorf("неожиданный ответ при истекшем контексте: %q", text)
+	}
+}
+
+func TestExistenceChecksReportDatabaseError(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddGroup(testCtx, "team")
+
+	db.readErr = errors.New("database is locked")
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/del_group team"))
+	if text := lastText(t, api); text != dbErrorText {
+		t.Errorf("неожиданный ответ при ошибке базы: %q", text)
+	}
+	if !db.hasGroup("team") {
+		t.Error("группа удалена, хотя проверка завершилась ошибкой")
+	}
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/cancel"))
+	if text := lastText(t, api); text != dbErrorText {
+		t.Errorf("неожиданный ответ /cancel при ошибке базы: %q", text)
+	}
+}
+
+func TestRemoveCommands(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddUser(testCtx, testUserID+1, "other", "", "")
+	db.AddChat(testCtx, testTargetID, "team chat")
+	db.AddGroup(testCtx, "team")
+	for _, userID := range []int64{testUserID, testUserID + 1} {
+		db.AddUserToChat(testCtx, userID, testTargetID)
+		db.AddUserToGroup(testCtx, userID, "team")
+	}
+	db.LinkGroupToChat(testCtx, "team", testTargetID)
+
+	cases := []struct {
+		command string
+		reply   string
+	}{
+		{"/remove_from_chat 200 -300", "Пользователь удален из чата"},
+		{"/remove_users_from_chat -300 201", "Пользователи удалены из чата"},
+		{"/remove_from_group 200 team", "Пользователь удален из группы"},
+		{"/remove_users_from_group team 201", "Пользователи удалены из группы"},
+		{"/unlink_group_chat team -300", "Группа отвязана от чата"},
+		{"/unlink_group_chat team -300", "Группа team не привязана к чату -300"},
+	}
+	for _, c := range cases {
+		b.HandleCommand(testCtx, commandUpdate(testAdminID, c.command))
+		if text := lastText(t, api); text != c.reply {
+			t.Errorf("%s: неожиданный ответ: %q", c.command, text)
+		}
+	}
+	if users, _ := db.GetUsersForChat(testCtx, testTargetID); len(users) != 0 || db.inGroup(testUserID, "team") || db.linked("team", testTargetID) {
+		t.Error("связи не удалены")
+	}
+}
+
+func TestRestoreAndPurge(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.DeleteUser(testCtx, testUserID)
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/deleted"))
+	if text := lastText(t, api); !strings.Contains(text, "user 200 - @user") {
+		t.Errorf("удаленный пользователь не показан: %q", text)
+	}
+
+	cases := []struct {
+		command string
+		reply   string
+	}{
+		{"/restore table 200", "Неизвестный тип table. Допустимые типы: user, chat, group"},
+		{"/restore user abc", "Ошибка восстановления: неверный формат id: abc"},
+		{"/restore user 200", "Запись восстановлена. Связи с чатами и группами нужно добавить заново"},
+		{"/purge user 200", "Запись удалена окончательно"},
+		{"/purge user 200", "Ошибка окончательного удаления: пользователь не найден: 200"},
+	}
+	for _, c := range cases {
+		b.HandleCommand(testCtx, commandUpdate(testAdminID, c.command))
+		if text := lastText(t, api); text != c.reply {
+			t.Errorf("%s: неожиданный ответ: %q", c.command, text)
+		}
+	}
+
+	db.AddChat(testCtx, testChatID, "chat")
+	db.GrantRole(testCtx, testUserID, models.RoleManager, testChatID)
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/purge user 1"))
+	if text := lastText(t, api); text != "У вас нет доступа к этой функции." {
+		t.Errorf("менеджер чата выполнил /purge: %q", text)
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddChat(testCtx, testTargetID, "team chat")
+	db.AddGroup(testCtx, "team")
+
+	cases := map[string]string{
+		"/list_users":  "Список пользователей",
+		"/list_chats":  "Список чатов",
+		"/list_groups": "Список групп",
+	}
+	for command, want := range cases {
+		b.HandleCommand(testCtx, commandUpdate(testAdminID, command))
+		if text := lastText(t, api); !strings.HasPrefix(text, want) {
+			t.Errorf("%s: получено %q, ожидалось начало %q", command, text, want)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	b, api, _ := newTestBot()
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/nonexistent"))
+	if text := lastText(t, api); !strings.HasPrefix(text, "Неизвестная команда") {
+		t.Errorf("неожиданный ответ: %q", text)
+	}
+}
+
+func TestHelpListsRegisteredCommands(t *testing.T) {
+	b, api, _ := newTestBot()
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/help"))
+	text := lastText(t, api)
+	for _, cmd := range b.commands.commands {
+		if !strings.Contains(text, cmd.usage()) {
+			t.Errorf("справка не содержит %q", cmd.usage())
+		}
+	}
+}
+
+func TestCommandAliasAndSuggestions(t *testing.T) {
+	b, _, _ := newTestBot()
+	if cmd, ok := b.commands.lookup("everyone"); !ok || cmd.Name != "all" {
+		t.Errorf("псевдоним /everyone не ведет к /all")
+	}
+
+	b, api, _ := newTestBot()
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/list"))
+	if text := lastText(t, api); !strings.HasPrefix(text, "Возможно, вы имели в виду:") {
+		t.Errorf("ожидались подсказки, получено %q", text)
+	}
+}
+
+func TestRenameGroup(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddChat(testCtx, testTargetID, "team chat")
+	db.AddGroup(testCtx, "team")
+	db.AddUserToGroup(testCtx, testUserID, "team")
+	db.LinkGroupToChat(testCtx, "team", testTargetID)
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/rename_group team devs"))
+	if text := lastText(t, api); text != "Группа успешно переименована" {
+		t.Fatalf("неожиданный ответ: %q", text)
+	}
+	if db.hasGroup("team") || !db.inGroup(testUserID, "devs") || !db.linked("devs", testTargetID) {
+		t.Error("участники и привязки не перенесены на новое название группы")
+	}
+}
+
+func TestChatAdminCannotManageSharedGroup(t *testing.T) {
+	b, api, db := newTestBot()
+	api.admins = []int64{testUserID}
+	db.AddChat(testCtx, testChatID, "chat A")
+	db.AddChat(testCtx, testTargetID, "chat B")
+	db.AddGroup(testCtx, "team")
+	db.LinkGroupToChat(testCtx, "team", testTargetID)
+
+	// Администратор чата A не может привязать чужую группу к своему чату
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/link_group_chat team"))
+	if text := lastText(t, api); text != "У вас нет доступа к этой функции." {
+		t.Fatalf("ожидался отказ в доступе, получено %q", text)
+	}
+	if db.linked("team", testChatID) {
+		t.Fatal("администратор чата привязал чужую группу")
+	}
+
+	// Даже если группу привязал глобальный администратор, общей группой
+	// администратор одного из чатов управлять не может
+	db.LinkGroupToChat(testCtx, "team", testChatID)
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/rename_group team mine"))
+	if text := lastText(t, api); text != "У вас нет доступа к этой функции." {
+		t.Fatalf("ожидался отказ в доступе, получено %q", text)
+	}
+	if !db.hasGroup("team") || db.hasGroup("mine") {
+		t.Error("администратор чата переименовал группу, общую с другим чатом")
+	}
+
+	// Группой только своего чата администратор чата управляет
+	db.UnlinkGroupFromChat(testCtx, "team", testTargetID)
+	b.HandleCommand(testCtx, commandUpdate(testUserID, "/rename_group team mine"))
+	if text := lastText(t, api); text != "Группа успешно переименована" {
+		t.Errorf("неожиданный ответ: %q", text)
+	}
+}
+
+func TestSetUsernameAndRenameChat(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "old", "", "")
+	db.AddChat(testCtx, testTargetID, "old title")
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/set_username 200 @new"))
+	if user, _ := db.GetUser(testCtx, testUserID); lastText(t, api) != "Username успешно изменен" || user.Username != "new" {
+		t.Errorf("username не изменен: %q", lastText(t, api))
+	}
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/rename_chat -300 new title"))
+	if chat, _ := db.GetChat(testCtx, testTargetID); lastText(t, api) != "Название чата успешно изменено" || chat.Title != "new title" {
+		t.Errorf("название чата не изменено: %q", lastText(t, api))
+	}
+}
+
+// buttonTexts возвращает подписи кнопок последнего отправленного сообщения
+func buttonTexts(api *fakeAPI) []string {
+	var texts []string
+	for i := len(api.sent) - 1; i >= 0; i-- {
+		msg, ok := api.sent[i].(tgbotapi.MessageConfig)
+		if !ok {
+			continue
+		}
+		if markup, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+			for _, row := range markup.InlineKeyboard {
+				for _, button := range row {
+					texts = append(texts, button.Text)
+				}
+			}
+		}
+		break
+	}
+	return texts
+}
+
+func TestUserListsLabelUsersWithoutUsername(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "", "Иван", "Петров")
+	db.AddChat(testCtx, testTargetID, "team")
+
+	b.ShowUsersList(testCtx, testChatID, 1, nil)
+	if text := lastText(t, api); !strings.Contains(text, "Иван Петров") {
+		t.Errorf("в списке пользователей нет имени: %q", text)
+	}
+	if buttons := strings.Join(buttonTexts(api), "\n"); !strings.Contains(buttons, "👤 Иван Петров") {
+		t.Errorf("кнопка пользователя без имени: %q", buttons)
+	}
+
+	b.ShowUsersToAddToChat(testCtx, testChatID, testTargetID, 1, nil)
+	if buttons := strings.Join(buttonTexts(api), "\n"); !strings.Contains(buttons, "➕ Иван Петров") {
+		t.Errorf("кнопка добавления пользователя без username: %q", buttons)
+	}
+}
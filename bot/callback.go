@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Формат callback data: "<версия><действие>|<аргумент>|<аргумент>...".
+// Числа кодируются в base36, группа передается своим ID, который не меняется при переименовании.
+const (
+	callbackVersion       = "2"
+	callbackSeparator     = "|"
+	maxCallbackDataLength = 64
+)
+
+// callbackAction - действие кнопки
+type callbackAction string
+
+const (
+	actAdminPanel      callbackAction = "ap"
+	actViewMenu        callbackAction = "vm"
+	actRelations       callbackAction = "rl"
+	actUsers           callbackAction = "ul"
+	actChats           callbackAction = "cl"
+	actGroups          callbackAction = "gl"
+	actCreateUser      callbackAction = "cu"
+	actCreateChat      callbackAction = "cc"
+	actCreateGroup     callbackAction = "cg"
+	actUserInfo        callbackAction = "ui"
+	actChatInfo        callbackAction = "ci"
+	actGroupInfo       callbackAction = "gi"
+	actEditUser        callbackAction = "eu"
+	actEditChat        callbackAction = "ec"
+	actEditGroup       callbackAction = "eg"
+	actDeleteUser      callbackAction = "du"
+	actDeleteChat      callbackAction = "dc"
+	actDeleteGroup     callbackAction = "dg"
+	actUsersToChat     callbackAction = "uc"
+	actAddUserToChat   callbackAction = "ac"
+	actUsersToGroup    callbackAction = "ug"
+	actAddUserToGroup  callbackAction = "ag"
+	actRenameUser      callbackAction = "ru"
+	actRenameChat      callbackAction = "rc"
+	actRenameGroup     callbackAction = "rg"
+	actUserLeaveChat   callbackAction = "lc"
+	actUserLeaveGroup  callbackAction = "lg"
+	actChatRemoveUser  callbackAction = "xc"
+	actChatUnlinkGroup callbackAction = "xu"
+	actGroupRemoveUser callbackAction = "xg"
+	actGroupUnlinkChat callbackAction = "xv"
+	actConvBack        callbackAction = "cb"
+	actConvCancel      callbackAction = "cx"
+	actConvSkip        callbackAction = "cs"
+	actConvConfirm     callbackAction = "ck"
+)
+
+// callbackField - поле callback, которое передается в данных кнопки
+type callbackField int
+
+const (
+	fieldChat callbackField = iota
+	fieldUser
+	fieldGroup
+	fieldPage
+)
+
+// callbackSchemas описывает, какие поля и в каком порядке передает каждое действие
+var callbackSchemas = map[callbackAction][]callbackField{
+	actAdminPanel:      nil,
+	actViewMenu:        nil,
+	actRelations:       nil,
+	actUsers:           {fieldPage},
+	actChats:           {fieldPage},
+	actGroups:          {fieldPage},
+	actCreateUser:      nil,
+	actCreateChat:      nil,
+	actCreateGroup:     nil,
+	actUserInfo:        {fieldUser},
+	actChatInfo:        {fieldChat},
+	actGroupInfo:       {fieldGroup},
+	actEditUser:        {fieldUser},
+	actEditChat:        {fieldChat},
+	actEditGroup:       {fieldGroup},
+	actDeleteUser:      {fieldUser},
+	actDeleteChat:      {fieldChat},
+	actDeleteGroup:     {fieldGroup},
+	actUsersToChat:     {fieldChat, fieldPage},
+	actAddUserToChat:   {fieldChat, fieldUser, fieldPage},
+	actUsersToGroup:    {fieldGroup, fieldPage},
+	actAddUserToGroup:  {fieldGroup, fieldUser, fieldPage},
+	actRenameUser:      {fieldUser},
+	actRenameChat:      {fieldChat},
+	actRenameGroup:     {fieldGroup},
+	actUserLeaveChat:   {fieldUser, fieldChat},
+	actUserLeaveGroup:  {fieldUser, fieldGroup},
+	actChatRemoveUser:  {fieldChat, fieldUser},
+	actChatUnlinkGroup: {fieldChat, fieldGroup},
+	actGroupRemoveUser: {fieldGroup, fieldUser},
+	actGroupUnlinkChat: {fieldGroup, fieldChat},
+	actConvBack:        nil,
+	actConvCancel:      nil,
+	actConvSkip:        nil,
+	actConvConfirm:     nil,
+}
+
+// callback - разобранные данные кнопки
+type callback struct {
+	Action  callbackAction
+	ChatID  int64
+	UserID  int64
+	GroupID uint
+	// Group - название группы GroupID, заполняется при обработке нажатия
+	Group string
+	Page  int
+}
+
+// errCallbackOutdated означает, что кнопка создана старой версией бота
+var errCallbackOutdated = errors.New("кнопка устарела")
+
+// encodeCallback кодирует callback в строку не длиннее 64 байт
+func encodeCallback(cb callback) string {
+	schema, ok := callbackSchemas[cb.Action]
+	if !ok {
+		panic(fmt.Sprintf("неизвестное действие callback: %q", cb.Action))
+	}
+
+	parts := []string{callbackVersion + string(cb.Action)}
+	for _, field := range schema {
+		switch field {
+		case fieldChat:
+			parts = append(parts, strconv.FormatInt(cb.ChatID, 36))
+		case fieldUser:
+			parts = append(parts, strconv.FormatInt(cb.UserID, 36))
+		case fieldPage:
+			parts = append(parts, strconv.Itoa(cb.Page))
+		case fieldGroup:
+			parts = append(parts, strconv.FormatUint(uint64(cb.GroupID), 36))
+		}
+	}
+	return strings.Join(parts, callbackSeparator)
+}
+
+// decodeCallback разбирает callback data
+func decodeCallback(data string) (callback, error) {
+	if !strings.HasPrefix(data, callbackVersion) {
+		return callback{}, errCallbackOutdated
+	}
+
+	parts := strings.Split(strings.TrimPrefix(data, callbackVersion), callbackSeparator)
+	cb := callback{Action: callbackAction(parts[0])}
+	schema, ok := callbackSchemas[cb.Action]
+	if !ok {
+		return callback{}, fmt.Errorf("неизвестное действие %q", parts[0])
+	}
+	if len(parts)-1 != len(schema) {
+		return callback{}, fmt.Errorf("неверное количество аргументов для действия %q", cb.Action)
+	}
+
+	for i, field := range schema {
+		value := parts[i+1]
+		var err error
+		switch field {
+		case fieldChat:
+			cb.ChatID, err = strconv.ParseInt(value, 36, 64)
+		case fieldUser:
+			cb.UserID, err = strconv.ParseInt(value, 36, 64)
+		case fieldPage:
+			cb.Page, err = strconv.Atoi(value)
+		case fieldGroup:
+			var id uint64
+			id, err = strconv.ParseUint(value, 36, 32)
+			cb.GroupID = uint(id)
+		}
+		if err != nil {
+			return callback{}, fmt.Errorf("неверный аргумент %q для действия %q", value, cb.Action)
+		}
+	}
+	return cb, nil
+}
+
+// hasGroup сообщает, передает ли действие группу
+func (cb callback) hasGroup() bool {
+	for _, field := range callbackSchemas[cb.Action] {
+		if field == fieldGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// button создает inline-кнопку с закодированным callback
+func (b *TelegramBot) button(text string, cb callback) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, encodeCallback(cb))
+}
+
+// permission возвращает право, необходимое для обработки callback
+func (cb callback) permission() Permission {
+	switch cb.Action {
+	case actCreateUser, actEditUser, actDeleteUser, actRenameUser:
+		return PermManageUsers
+	case actCreateChat, actEditChat, actDeleteChat, actRenameChat:
+		return PermManageChats
+	case actCreateGroup, actEditGroup, actDeleteGroup, actRenameGroup,
+		actChatUnlinkGroup, actGroupUnlinkChat:
+		return PermManageGroups
+	case actUsersToChat, actAddUserToChat, actUsersToGroup, actAddUserToGroup,
+		actUserLeaveChat, actUserLeaveGroup, actChatRemoveUser, actGroupRemoveUser:
+		return PermManageMembers
+	default:
+		return PermAdminPanel
+	}
+}
+
+// scopeChatID возвращает чат, в рамках которого проверяются права на callback.
+// Для действий с конкретным чатом это целевой чат, а списки всех сущностей доступны только глобально. Действия с группами проверяет callbackScope.
+func (cb callback) scopeChatID() int64 {
+	switch cb.Action {
+	case actChatInfo, actUsersToChat, actAddUserToChat, actUserLeaveChat,
+		actChatRemoveUser, actChatUnlinkGroup, actGroupUnlinkChat:
+		return cb.ChatID
+	default:
+		return 0
+	}
+}
+
+// callbackScope возвращает чат для проверки прав на callback. Как и для команд с группами,
+// менеджеры чата управляют только группами, привязанными к одному чату, в котором нажата кнопка,
+// поэтому для остальных групп учитываются только глобальные роли.
+func (b *TelegramBot) callbackScope(ctx context.Context, cb callback, sourceChatID int64) int64 {
+	switch cb.Action {
+	case actGroupInfo, actUsersToGroup, actAddUserToGroup, actUserLeaveGroup, actGroupRemoveUser:
+		return b.groupScope(ctx, cb.Group, sourceChatID)
+	default:
+		return cb.scopeChatID()
+	}
+}
@@ -0,0 +1,246 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestCallbackRoundTrip(t *testing.T) {
+	cases := []callback{
+		{Action: actAdminPanel},
+		{Action: actUsers, Page: 3},
+		{Action: actUserInfo, UserID: 399040843},
+		{Action: actChatInfo, ChatID: -1001234567890},
+		{Action: actUsersToChat, ChatID: -1001234567890, Page: 2},
+		{Action: actAddUserToChat, ChatID: -1001234567890, UserID: 7, Page: 2},
+		{Action: actGroupInfo, GroupID: 12},
+		{Action: actUsersToGroup, GroupID: 4294967295, Page: 4},
+		{Action: actAddUserToGroup, GroupID: 1, UserID: 42, Page: 1},
+		{Action: actUserLeaveGroup, UserID: 9223372036854775807, GroupID: 4294967295},
+	}
+	for _, want := range cases {
+		data := encodeCallback(want)
+		if len(data) > maxCallbackDataLength {
+			t.Errorf("%+v: длина %d превышает %d байт", want, len(data), maxCallbackDataLength)
+		}
+		got, err := decodeCallback(data)
+		if err != nil {
+			t.Errorf("%+v: ошибка декодирования %q: %v", want, data, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("декодировано %+v, ожидалось %+v", got, want)
+		}
+	}
+}
+
+func TestCallbackDecodeErrors(t *testing.T) {
+	cases := []string{
+		"admin_users",
+		"add_users_to_chat_page_-300_2",
+		// Кнопки прежней версии передавали название группы
+		"1gi|dev",
+		"2zz",
+		"2ui",
+		"2ui|not-a-number",
+		"2gi|~unknown",
+		"2gi|-1",
+	}
+	for _, data := range cases {
+		if _, err := decodeCallback(data); err == nil {
+			t.Errorf("%q: ожидалась ошибка", data)
+		}
+	}
+}
+
+// callbackUpdate создает нажатие кнопки в сообщении с ID 1 в групповом чате testChatID
+func callbackUpdate(userID int64, data string) tgbotapi.Update {
+	return tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "query",
+			From:    &tgbotapi.User{ID: userID},
+			Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: testChatID, Type: "group"}},
+			Data:    data,
+		},
+	}
+}
+
+// lastAnswer возвращает последний ответ бота на callback-запрос
+func lastAnswer(t *testing.T, api *fakeAPI) tgbotapi.CallbackConfig {
+	t.Helper()
+	for i := len(api.sent) - 1; i >= 0; i-- {
+		if answer, ok := api.sent[i].(tgbotapi.CallbackConfig); ok {
+			return answer
+		}
+	}
+	t.Fatal("бот не ответил на callback-запрос")
+	return tgbotapi.CallbackConfig{}
+}
+
+func TestCallbackOutdatedButton(t *testing.T) {
+	b, api, _ := newTestBot()
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, "admin_users"))
+	if answer := lastAnswer(t, api); !answer.ShowAlert || !strings.HasPrefix(answer.Text, "Кнопка устарела") {
+		t.Errorf("неожиданный ответ: %+v", answer)
+	}
+}
+
+func TestCallbackEditsMessageInPlace(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, encodeCallback(callback{Action: actUsers, Page: 1})))
+	if len(api.texts()) != 0 {
+		t.Errorf("ожидалось редактирование, отправлены новые сообщения: %q", api.texts())
+	}
+	var edited bool
+	for _, c := range api.sent {
+		if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok && edit.MessageID == 1 {
+			edited = strings.HasPrefix(edit.Text, "Список пользователей") && edit.ReplyMarkup != nil
+		}
+	}
+	if !edited {
+		t.Error("сообщение со списком пользователей не отредактировано")
+	}
+	lastAnswer(t, api)
+}
+
+func TestCallbackFallsBackToSend(t *testing.T) {
+	b, api, _ := newTestBot()
+	api.editErr = errors.New("Bad Request: message can't be edited")
+
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, encodeCallback(callback{Action: actGroups, Page: 1})))
+	if text := lastText(t, api); !strings.HasPrefix(text, "Список групп") {
+		t.Errorf("неожиданный ответ: %q", text)
+	}
+	lastAnswer(t, api)
+}
+
+func TestCallbackPermissionDenied(t *testing.T) {
+	b, api, _ := newTestBot()
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testUserID, encodeCallback(callback{Action: actUsers, Page: 1})))
+	if answer := lastAnswer(t, api); !answer.ShowAlert || answer.Text != "У вас нет доступа к этой функции." {
+		t.Errorf("неожиданный ответ: %+v", answer)
+	}
+}
+
+func TestCallbackUserLeaveGroup(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddGroup(testCtx, "back_end")
+	db.AddUserToGroup(testCtx, testUserID, "back_end")
+
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, encodeCallback(callback{Action: actUserLeaveGroup, UserID: testUserID, GroupID: db.groupID("back_end")})))
+	if db.inGroup(testUserID, "back_end") {
+		t.Error("пользователь не удален из группы")
+	}
+	if answer := lastAnswer(t, api); answer.Text != "Пользователь удален из группы" {
+		t.Errorf("неожиданный ответ: %+v", answer)
+	}
+}
+
+func TestCallbackGroupButtonAfterRenameAndDelete(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddGroup(testCtx, "team")
+	data := encodeCallback(callback{Action: actGroupInfo, GroupID: db.groupID("team")})
+
+	// Кнопка ссылается на ID группы и работает после переименования
+	db.RenameGroup(testCtx, "team", "crew")
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, data))
+	var text string
+	for _, c := range api.sent {
+		if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok {
+			text = edit.Text
+		}
+	}
+	if !strings.HasPrefix(text, "Информация о группе: crew") {
+		t.Errorf("кнопка не открыла переименованную группу: %q", text)
+	}
+
+	db.DeleteGroup(testCtx, "crew")
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, data))
+	if answer := lastAnswer(t, api); !answer.ShowAlert || !strings.HasPrefix(answer.Text, "Группа не найдена") {
+		t.Errorf("неожиданный ответ для удаленной группы: %+v", answer)
+	}
+}
+
+func TestCallbackChatRemoveUser(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddUser(testCtx, testUserID, "user", "", "")
+	db.AddChat(testCtx, testTargetID, "team chat")
+	db.AddUserToChat(testCtx, testUserID, testTargetID)
+
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, encodeCallback(callback{Action: actChatRemoveUser, ChatID: testTargetID, UserID: testUserID})))
+	if users, _ := db.GetUsersForChat(testCtx, testTargetID); len(users) != 0 {
+		t.Error("пользователь не удален из чата")
+	}
+	if answer := lastAnswer(t, api); answer.Text != "Пользователь удален из чата" {
+		t.Errorf("неожиданный ответ: %+v", answer)
+	}
+}
+
+func TestCallbackShowsLoadError(t *testing.T) {
+	b, api, db := newTestBot()
+	db.readErr = errors.New("database is locked")
+
+	b.HandleCallbackQuery(testCtx, callbackUpdate(testAdminID, encodeCallback(callback{Action: actUsers, Page: 1})))
+	var text string
+	for _, c := range api.sent {
+		if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok {
+			text = edit.Text
+		}
+	}
+	if !strings.HasPrefix(text, "Не удалось загрузить список пользователей") {
+		t.Errorf("ошибка базы не показана: %q", text)
+	}
+}
+
+// TestCallbackUnlinkedGroupRequiresGlobalRole проверяет, что администратор чата не может
+// через подделанные кнопки управлять группой, которая не привязана к его чату
+func TestCallbackUnlinkedGroupRequiresGlobalRole(t *testing.T) {
+	b, api, db := newTestBot()
+	api.admins = []int64{testUserID}
+	db.AddUser(testCtx, testUserID, "manager", "", "")
+	db.AddUser(testCtx, 300, "member", "", "")
+	db.AddChat(testCtx, testTargetID, "team")
+	db.AddGroup(testCtx, "dev")
+
+	// pressIn нажимает кнопку в групповом чате, где testUserID - администратор
+	pressIn := func(cb callback) {
+		update := callbackUpdate(testUserID, encodeCallback(cb))
+		update.CallbackQuery.Message.Chat = &tgbotapi.Chat{ID: testTargetID, Type: "supergroup"}
+		b.HandleCallbackQuery(testCtx, update)
+	}
+
+	for _, cb := range []callback{
+		{Action: actGroupInfo, GroupID: db.groupID("dev")},
+		{Action: actUsersToGroup, GroupID: db.groupID("dev"), Page: 1},
+		{Action: actAddUserToGroup, GroupID: db.groupID("dev"), UserID: 300, Page: 1},
+	} {
+		pressIn(cb)
+		if answer := lastAnswer(t, api); answer.Text != "У вас нет доступа к этой функции." {
+			t.Errorf("%s: администратор чата получил доступ к непривязанной группе: %+v", cb.Action, answer)
+		}
+	}
+	if db.inGroup(300, "dev") {
+		t.Fatal("пользователь добавлен в непривязанную группу")
+	}
+
+	// После привязки группы к чату администратор чата может ею управлять
+	db.LinkGroupToChat(testCtx, "dev", testTargetID)
+	pressIn(callback{Action: actAddUserToGroup, GroupID: db.groupID("dev"), UserID: 300, Page: 1})
+	if !db.inGroup(300, "dev") {
+		t.Error("администратор чата не смог добавить пользователя в привязанную группу")
+	}
+
+	// Группа, общая с другим чатом, снова требует глобальной роли
+	db.AddChat(testCtx, testChatID, "other")
+	db.LinkGroupToChat(testCtx, "dev", testChatID)
+	pressIn(callback{Action: actGroupRemoveUser, GroupID: db.groupID("dev"), UserID: 300})
+	if answer := lastAnswer(t, api); answer.Text != "У вас нет доступа к этой функции." || !db.inGroup(300, "dev") {
+		t.Error("администратор чата исключил пользователя из группы, общей с другим чатом")
+	}
+}
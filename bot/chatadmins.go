@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatAdminsTTL - время, в течение которого список администраторов чата берется из кеша
+const chatAdminsTTL = 5 * time.Minute
+
+type chatAdminsEntry struct {
+	admins  map[int64]bool
+	expires time.Time
+}
+
+// chatAdminsCache кеширует администраторов чатов, полученных через getChatAdministrators
+type chatAdminsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int64]chatAdminsEntry
+}
+
+func newChatAdminsCache(ttl time.Duration) *chatAdminsCache {
+	return &chatAdminsCache{
+		ttl:     ttl,
+		entries: make(map[int64]chatAdminsEntry),
+	}
+}
+
+func (c *chatAdminsCache) get(chatID int64, now time.Time) (map[int64]bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[chatID]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry.admins, true
+}
+
+func (c *chatAdminsCache) set(chatID int64, admins map[int64]bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[chatID] = chatAdminsEntry{admins: admins, expires: now.Add(c.ttl)}
+}
+
+func (c *chatAdminsCache) invalidate(chatID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, chatID)
+}
+
+// InvalidateChatAdmins сбрасывает кеш администраторов чата, например после изменения прав участника
+func (b *TelegramBot) InvalidateChatAdmins(chatID int64) {
+	b.chatAdmins.invalidate(chatID)
+}
+
+// isChatAdministrator проверяет, является ли пользователь администратором группового чата в Telegram
+func (b *TelegramBot) isChatAdministrator(chatID int64, userID int64) bool {
+	// У личных чатов положительный ID, администраторов у них нет
+	if chatID >= 0 {
+		return false
+	}
+
+	now := time.Now()
+	admins, ok := b.chatAdmins.get(chatID, now)
+	if !ok {
+		members, err := b.bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+			ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+		})
+		if err != nil {
+			log.Printf("Ошибка получения администраторов чата %d: %v", chatID, err)
+			return false
+		}
+
+		admins = make(map[int64]bool, len(members))
+		for _, member := range members {
+			if member.User != nil {
+				admins[member.User.ID] = true
+			}
+		}
+		b.chatAdmins.set(chatID, admins, now)
+	}
+
+	return admins[userID]
+}
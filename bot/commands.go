@@ -0,0 +1,829 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newCommands описывает все команды бота. Из этого списка строятся обработка команд,
+// справка, подсказки и меню команд Telegram.
+func (b *TelegramBot) newCommands() []*command {
+	return []*command{
+		{
+			Name:         "all",
+			Aliases:      []string{"everyone"},
+			Description:  "упомянуть всех пользователей в чате",
+			Translations: map[string]string{"en": "mention everyone in the chat"},
+			Section:      sectionMain,
+			Handler:      b.cmdAll,
+		},
+		{
+			Name:         "group",
+			Args:         []argSpec{{Name: "название"}},
+			Description:  "упомянуть пользователей группы, привязанной к чату",
+			Translations: map[string]string{"en": "mention members of a group linked to the chat"},
+			Section:      sectionMain,
+			Suggest: func(c *commandContext) []string {
+				groups, err := b.db.GetGroupsForChat(c.ctx, c.chatID)
+				if err != nil {
+					log.Printf("Ошибка получения групп чата %d: %v", c.chatID, err)
+					return nil
+				}
+				var suggestions []string
+				for _, group := range groups {
+					suggestions = append(suggestions, "/group "+group.Name)
+				}
+				return suggestions
+			},
+			Handler: b.cmdGroup,
+		},
+		{
+			Name: "mute_mentions",
+			Args: []argSpec{
+				{Name: "all", Optional: true},
+				{Name: "ЧЧ:ММ-ЧЧ:ММ", Optional: true},
+				{Name: "часовой_пояс", Optional: true},
+			},
+			Description:  "не упоминать меня в этом чате (all - во всех чатах)",
+			Translations: map[string]string{"en": "stop mentioning me in this chat (all - in every chat)"},
+			Section:      sectionMain,
+			CustomArgs:   true,
+			Handler:      func(c *commandContext) { b.handleMuteMentions(c.ctx, c.msg) },
+		},
+		{
+			Name:         "unmute_mentions",
+			Args:         []argSpec{{Name: "all", Optional: true}},
+			Description:  "снова включить упоминания",
+			Translations: map[string]string{"en": "turn mentions back on"},
+			Section:      sectionMain,
+			CustomArgs:   true,
+			Handler:      func(c *commandContext) { b.handleUnmuteMentions(c.ctx, c.msg) },
+		},
+		{
+			Name:         "cancel",
+			Description:  "отменить пошаговый ввод",
+			Translations: map[string]string{"en": "cancel step-by-step input"},
+			Section:      sectionMain,
+			Handler:      b.cmdCancel,
+		},
+		{
+			Name:         "help",
+			Description:  "показать это сообщение",
+			Translations: map[string]string{"en": "show this message"},
+			Section:      sectionMain,
+			Handler:      func(c *commandContext) { b.ShowHelp(c.chatID) },
+		},
+		{
+			Name:         "start",
+			Description:  "показать админ-панель (только для администраторов)",
+			Translations: map[string]string{"en": "show the admin panel (admins only)"},
+			Section:      sectionMain,
+			Handler:      b.cmdAdmin,
+		},
+		{
+			Name:         "admin",
+			Description:  "показать админ-панель",
+			Translations: map[string]string{"en": "show the admin panel"},
+			Section:      sectionAdmin,
+			Handler:      b.cmdAdmin,
+		},
+		{
+			Name:         "add_user",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "username"}},
+			Description:  "добавить пользователя",
+			Translations: map[string]string{"en": "add a user"},
+			Section:      sectionAdmin,
+			Permission:   PermManageUsers,
+			Handler:      b.cmdAddUser,
+		},
+		{
+			Name:         "del_user",
+			Args:         []argSpec{{Name: "user_id", Type: argID}},
+			Description:  "удалить пользователя",
+			Translations: map[string]string{"en": "delete a user"},
+			Section:      sectionAdmin,
+			Permission:   PermManageUsers,
+			Suggest:      b.suggestUsers("/del_user %d"),
+			Handler:      b.cmdDelUser,
+		},
+		{
+			Name:         "set_username",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "username"}},
+			Description:  "изменить сохраненный username пользователя",
+			Translations: map[string]string{"en": "change a user's stored username"},
+			Section:      sectionAdmin,
+			Permission:   PermManageUsers,
+			Handler:      b.cmdSetUsername,
+		},
+		{
+			Name:         "list_users",
+			Description:  "показать список пользователей",
+			Translations: map[string]string{"en": "list users"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      func(c *commandContext) { b.ShowUsersList(c.ctx, c.chatID, 1, nil) },
+		},
+		{
+			Name:         "add_chat",
+			Args:         []argSpec{{Name: "chat_id", Type: argID}, {Name: "title", Variadic: true}},
+			Description:  "добавить чат",
+			Translations: map[string]string{"en": "add a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageChats,
+			Handler:      b.cmdAddChat,
+		},
+		{
+			Name:         "del_chat",
+			Args:         []argSpec{{Name: "chat_id", Type: argID}},
+			Description:  "удалить чат",
+			Translations: map[string]string{"en": "delete a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageChats,
+			Suggest:      b.suggestChats("/del_chat %d"),
+			Handler:      b.cmdDelChat,
+		},
+		{
+			Name:         "rename_chat",
+			Args:         []argSpec{{Name: "chat_id", Type: argID}, {Name: "title", Variadic: true}},
+			Description:  "изменить название чата",
+			Translations: map[string]string{"en": "change a chat's title"},
+			Section:      sectionAdmin,
+			Permission:   PermManageChats,
+			Handler:      b.cmdRenameChat,
+		},
+		{
+			Name:         "list_chats",
+			Description:  "показать список чатов",
+			Translations: map[string]string{"en": "list chats"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      func(c *commandContext) { b.ShowChatsList(c.ctx, c.chatID, 1, nil) },
+		},
+		{
+			Name:         "add_group",
+			Args:         []argSpec{{Name: "name"}},
+			Description:  "создать группу (в групповом чате - сразу привязать к нему)",
+			Translations: map[string]string{"en": "create a group (in a group chat - link it right away)"},
+			Section:      sectionAdmin,
+			Permission:   PermManageGroups,
+			Scope:        func(c *commandContext) int64 { return c.chatID },
+			Handler:      b.cmdAddGroup,
+		},
+		{
+			Name:         "del_group",
+			Args:         []argSpec{{Name: "name"}},
+			Description:  "удалить группу",
+			Translations: map[string]string{"en": "delete a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageGroups,
+			Suggest:      b.suggestGroups("/del_group %s"),
+			Handler:      b.cmdDelGroup,
+		},
+		{
+			Name:         "rename_group",
+			Args:         []argSpec{{Name: "name"}, {Name: "new_name"}},
+			Description:  "переименовать группу",
+			Translations: map[string]string{"en": "rename a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageGroups,
+			Scope:        b.linkedGroupScope("name"),
+			Handler:      b.cmdRenameGroup,
+		},
+		{
+			Name:         "list_groups",
+			Description:  "показать список групп",
+			Translations: map[string]string{"en": "list groups"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      func(c *commandContext) { b.ShowGroupsList(c.ctx, c.chatID, 1, nil) },
+		},
+		{
+			Name:         "add_to_chat",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "chat_id", Type: argID}},
+			Description:  "добавить пользователя в чат",
+			Translations: map[string]string{"en": "add a user to a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Handler:      b.cmdAddToChat,
+		},
+		{
+			Name:         "add_to_group",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "group_name"}},
+			Description:  "добавить пользователя в группу",
+			Translations: map[string]string{"en": "add a user to a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        b.linkedGroupScope("group_name"),
+			Handler:      b.cmdAddToGroup,
+		},
+		{
+			Name:         "link_group_chat",
+			Args:         []argSpec{{Name: "group_name"}, {Name: "chat_id", Type: argID, Optional: true}},
+			Description:  "связать группу с чатом (по умолчанию - с текущим)",
+			Translations: map[string]string{"en": "link a group to a chat (the current one by default)"},
+			Section:      sectionAdmin,
+			Permission:   PermManageGroups,
+			Suggest:      b.suggestGroups("/link_group_chat %s"),
+			Handler:      b.cmdLinkGroupChat,
+		},
+		{
+			Name:         "add_users_to_chat",
+			Args:         []argSpec{{Name: "chat_id", Type: argID}, {Name: "user_id", Type: argID, Variadic: true}},
+			Description:  "добавить несколько пользователей в чат",
+			Translations: map[string]string{"en": "add several users to a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Suggest:      b.suggestChats("/add_users_to_chat %d"),
+			Handler:      b.cmdAddUsersToChat,
+		},
+		{
+			Name:         "add_users_to_group",
+			Args:         []argSpec{{Name: "group_name"}, {Name: "user_id", Type: argID, Variadic: true}},
+			Description:  "добавить несколько пользователей в группу",
+			Translations: map[string]string{"en": "add several users to a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        b.linkedGroupScope("group_name"),
+			Handler:      b.cmdAddUsersToGroup,
+		},
+		{
+			Name:         "remove_from_chat",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "chat_id", Type: argID}},
+			Description:  "исключить пользователя из чата",
+			Translations: map[string]string{"en": "remove a user from a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Handler:      b.cmdRemoveFromChat,
+		},
+		{
+			Name:         "remove_users_from_chat",
+			Args:         []argSpec{{Name: "chat_id", Type: argID}, {Name: "user_id", Type: argID, Variadic: true}},
+			Description:  "исключить несколько пользователей из чата",
+			Translations: map[string]string{"en": "remove several users from a chat"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Handler:      b.cmdRemoveUsersFromChat,
+		},
+		{
+			Name:         "remove_from_group",
+			Args:         []argSpec{{Name: "user_id", Type: argID}, {Name: "group_name"}},
+			Description:  "исключить пользователя из группы",
+			Translations: map[string]string{"en": "remove a user from a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        b.linkedGroupScope("group_name"),
+			Handler:      b.cmdRemoveFromGroup,
+		},
+		{
+			Name:         "remove_users_from_group",
+			Args:         []argSpec{{Name: "group_name"}, {Name: "user_id", Type: argID, Variadic: true}},
+			Description:  "исключить несколько пользователей из группы",
+			Translations: map[string]string{"en": "remove several users from a group"},
+			Section:      sectionAdmin,
+			Permission:   PermManageMembers,
+			Scope:        b.linkedGroupScope("group_name"),
+			Handler:      b.cmdRemoveUsersFromGroup,
+		},
+		{
+			Name:         "unlink_group_chat",
+			Args:         []argSpec{{Name: "group_name"}, {Name: "chat_id", Type: argID, Optional: true}},
+			Description:  "отвязать группу от чата (по умолчанию - от текущего)",
+			Translations: map[string]string{"en": "unlink a group from a chat (the current one by default)"},
+			Section:      sectionAdmin,
+			Permission:   PermManageGroups,
+			Scope:        func(c *commandContext) int64 { return linkTargetChatID(c) },
+			Handler:      b.cmdUnlinkGroupChat,
+		},
+		{
+			Name:         "deleted",
+			Description:  "показать удаленных пользователей, чаты и группы",
+			Translations: map[string]string{"en": "list deleted users, chats and groups"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      b.cmdDeleted,
+		},
+		{
+			Name:         "restore",
+			Args:         []argSpec{{Name: "user|chat|group"}, {Name: "id"}},
+			Description:  "восстановить удаленного пользователя, чат или группу",
+			Translations: map[string]string{"en": "restore a deleted user, chat or group"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      b.cmdRestore,
+		},
+		{
+			Name:         "purge",
+			Args:         []argSpec{{Name: "user|chat|group"}, {Name: "id"}},
+			Description:  "удалить пользователя, чат или группу окончательно, вместе со всеми связями",
+			Translations: map[string]string{"en": "permanently delete a user, chat or group with all its links"},
+			Section:      sectionAdmin,
+			Permission:   PermAdminPanel,
+			Handler:      b.cmdPurge,
+		},
+		{
+			Name: "grant",
+			Args: []argSpec{
+				{Name: "user_id", Type: argID},
+				{Name: "role"},
+				{Name: "chat_id", Type: argID, Optional: true},
+			},
+			Description:  "выдать роль (owner, admin, moderator, manager)",
+			Translations: map[string]string{"en": "grant a role (owner, admin, moderator, manager)"},
+			Section:      sectionAdmin,
+			Permission:   PermManageRoles,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Handler:      b.handleGrant,
+		},
+		{
+			Name: "revoke",
+			Args: []argSpec{
+				{Name: "user_id", Type: argID},
+				{Name: "role"},
+				{Name: "chat_id", Type: argID, Optional: true},
+			},
+			Description:  "отозвать роль",
+			Translations: map[string]string{"en": "revoke a role"},
+			Section:      sectionAdmin,
+			Permission:   PermManageRoles,
+			Scope:        func(c *commandContext) int64 { return c.ID("chat_id") },
+			Handler:      b.handleRevoke,
+		},
+		{
+			Name:         "roles",
+			Description:  "показать роли пользователей",
+			Translations: map[string]string{"en": "show user roles"},
+			Section:      sectionAdmin,
+			Permission:   PermManageRoles,
+			Handler:      b.handleRoles,
+		},
+	}
+}
+
+// suggestUsers возвращает подсказки команды с ID всех пользователей
+func (b *TelegramBot) suggestUsers(format string) func(c *commandContext) []string {
+	return func(c *commandContext) []string {
+		users, err := b.db.ListUsers(c.ctx)
+		if err != nil {
+			log.Printf("Ошибка получения подсказок: %v", err)
+			return nil
+		}
+		var suggestions []string
+		for _, user := range users {
+			suggestions = append(suggestions, fmt.Sprintf(format, user.UserID))
+		}
+		return suggestions
+	}
+}
+
+// suggestChats возвращает подсказки команды с ID всех чатов
+func (b *TelegramBot) suggestChats(format string) func(c *commandContext) []string {
+	return func(c *commandContext) []string {
+		chats, err := b.db.ListChats(c.ctx)
+		if err != nil {
+			log.Printf("Ошибка получения подсказок: %v", err)
+			return nil
+		}
+		var suggestions []string
+		for _, chat := range chats {
+			suggestions = append(suggestions, fmt.Sprintf(format, chat.ChatID))
+		}
+		return suggestions
+	}
+}
+
+// suggestGroups возвращает подсказки команды с названиями всех групп
+func (b *TelegramBot) suggestGroups(format string) func(c *commandContext) []string {
+	return func(c *commandContext) []string {
+		groups, err := b.db.ListGroups(c.ctx)
+		if err != nil {
+			log.Printf("Ошибка получения подсказок: %v", err)
+			return nil
+		}
+		var suggestions []string
+		for _, group := range groups {
+			suggestions = append(suggestions, fmt.Sprintf(format, group.Name))
+		}
+		return suggestions
+	}
+}
+
+// linkedGroupScope возвращает чат для проверки прав на команду с группой
+func (b *TelegramBot) linkedGroupScope(arg string) func(c *commandContext) int64 {
+	return func(c *commandContext) int64 {
+		return b.groupScope(c.ctx, c.String(arg), c.chatID)
+	}
+}
+
+// linkTargetChatID возвращает чат для /link_group_chat: указанный в аргументах или текущий
+func linkTargetChatID(c *commandContext) int64 {
+	if c.Has("chat_id") {
+		return c.ID("chat_id")
+	}
+	return c.chatID
+}
+
+// sendText отправляет простое текстовое сообщение
+func (b *TelegramBot) sendText(chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	b.bot.Send(msg)
+}
+
+func (b *TelegramBot) cmdAdmin(c *commandContext) {
+	switch {
+	case b.IsAdmin(c.ctx, c.userID, 0):
+		b.ShowAdminPanel(c.chatID, nil)
+	case b.IsAdmin(c.ctx, c.userID, c.chatID):
+		// Администраторы чата управляют только своим чатом
+		b.ShowChatInfo(c.ctx, c.chatID, c.chatID, nil)
+	default:
+		b.sendText(c.chatID, "У вас нет доступа к этой функции.")
+	}
+}
+
+func (b *TelegramBot) cmdAll(c *commandContext) {
+	if !b.checkCooldown(c.ctx, "all", c.chatID, c.userID) {
+		return
+	}
+	users, err := b.db.GetUsersForMention(c.ctx, c.chatID, "")
+	if err != nil {
+		log.Printf("Ошибка получения пользователей для упоминания в чате %d: %v", c.chatID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if len(users) == 0 {
+		b.sendText(c.chatID, "В этом чате пока нет пользователей.")
+		return
+	}
+	if _, err := b.sendMentions(c.chatID, users); err != nil {
+		log.Printf("Ошибка отправки упоминаний: %v", err)
+	}
+	b.recordCooldown(c.ctx, "all", c.chatID, c.userID)
+}
+
+func (b *TelegramBot) cmdGroup(c *commandContext) {
+	groupName := c.String("название")
+	if errText := b.groupMentionError(c.ctx, c.chatID, groupName); errText != "" {
+		b.sendText(c.chatID, errText)
+		return
+	}
+	if !b.checkCooldown(c.ctx, "group", c.chatID, c.userID) {
+		return
+	}
+	users, err := b.db.GetUsersForMention(c.ctx, c.chatID, groupName)
+	if err != nil {
+		log.Printf("Ошибка получения пользователей для упоминания в чате %d: %v", c.chatID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if len(users) == 0 {
+		b.sendText(c.chatID, "В этой группе пока нет пользователей.")
+		return
+	}
+	if _, err := b.sendMentions(c.chatID, users); err != nil {
+		log.Printf("Ошибка отправки упоминаний: %v", err)
+	}
+	b.recordCooldown(c.ctx, "group", c.chatID, c.userID)
+}
+
+func (b *TelegramBot) cmdAddUser(c *commandContext) {
+	if err := b.db.AddUser(c.ctx, c.ID("user_id"), c.String("username"), "", ""); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления пользователя: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь успешно добавлен")
+}
+
+func (b *TelegramBot) cmdDelUser(c *commandContext) {
+	userID := c.ID("user_id")
+	found, err := b.db.UserExists(c.ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка проверки пользователя %d: %v", userID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if !found {
+		b.sendText(c.chatID, fmt.Sprintf("Пользователь не найден: %d", userID))
+		return
+	}
+	if err := b.db.DeleteUser(c.ctx, userID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления пользователя: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь успешно удален")
+}
+
+func (b *TelegramBot) cmdSetUsername(c *commandContext) {
+	username := strings.TrimPrefix(c.String("username"), "@")
+	if err := b.db.SetUsername(c.ctx, c.ID("user_id"), username); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка изменения username: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Username успешно изменен")
+}
+
+func (b *TelegramBot) cmdAddChat(c *commandContext) {
+	if err := b.db.AddChat(c.ctx, c.ID("chat_id"), c.String("title")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Чат успешно добавлен")
+}
+
+func (b *TelegramBot) cmdDelChat(c *commandContext) {
+	chatID := c.ID("chat_id")
+	found, err := b.db.ChatExists(c.ctx, chatID)
+	if err != nil {
+		log.Printf("Ошибка проверки чата %d: %v", chatID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if !found {
+		b.sendText(c.chatID, fmt.Sprintf("Чат не найден: %d", chatID))
+		return
+	}
+	if err := b.db.DeleteChat(c.ctx, chatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Чат успешно удален")
+}
+
+func (b *TelegramBot) cmdRenameChat(c *commandContext) {
+	if err := b.db.SetChatTitle(c.ctx, c.ID("chat_id"), c.String("title")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка изменения названия чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Название чата успешно изменено")
+}
+
+func (b *TelegramBot) cmdAddGroup(c *commandContext) {
+	name := c.String("name")
+	if err := b.db.AddGroup(c.ctx, name); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления группы: %v", err))
+		return
+	}
+
+	// Группа, созданная в групповом чате, сразу привязывается к нему
+	if !c.msg.Chat.IsPrivate() {
+		if err := b.db.LinkGroupToChat(c.ctx, name, c.chatID); err != nil {
+			b.sendText(c.chatID, fmt.Sprintf("Группа добавлена, но не привязана к чату: %v", err))
+			return
+		}
+		b.sendText(c.chatID, "Группа успешно добавлена и привязана к этому чату")
+		return
+	}
+
+	b.sendText(c.chatID, "Группа успешно добавлена")
+	if b.IsAdmin(c.ctx, c.userID, 0) {
+		b.ShowAdminPanel(c.chatID, nil)
+	}
+}
+
+func (b *TelegramBot) cmdDelGroup(c *commandContext) {
+	name := c.String("name")
+	found, err := b.db.GroupExists(c.ctx, name)
+	if err != nil {
+		log.Printf("Ошибка проверки группы %s: %v", name, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if !found {
+		b.sendText(c.chatID, fmt.Sprintf("Группа не найдена: %s", name))
+		return
+	}
+	if err := b.db.DeleteGroup(c.ctx, name); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления группы: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Группа успешно удалена")
+}
+
+func (b *TelegramBot) cmdRenameGroup(c *commandContext) {
+	if err := b.db.RenameGroup(c.ctx, c.String("name"), c.String("new_name")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка переименования группы: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Группа успешно переименована")
+}
+
+func (b *TelegramBot) cmdAddToChat(c *commandContext) {
+	if err := b.db.AddUserToChat(c.ctx, c.ID("user_id"), c.ID("chat_id")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления пользователя в чат: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь успешно добавлен в чат")
+}
+
+func (b *TelegramBot) cmdAddToGroup(c *commandContext) {
+	if err := b.db.AddUserToGroup(c.ctx, c.ID("user_id"), c.String("group_name")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления пользователя в группу: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь успешно добавлен в группу")
+}
+
+func (b *TelegramBot) cmdLinkGroupChat(c *commandContext) {
+	if err := b.db.LinkGroupToChat(c.ctx, c.String("group_name"), linkTargetChatID(c)); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка привязки группы к чату: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Группа успешно привязана к чату")
+}
+
+func (b *TelegramBot) cmdAddUsersToChat(c *commandContext) {
+	result, err := b.db.AddUsersToChat(c.ctx, c.IDs("user_id"), c.ID("chat_id"))
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления пользователей в чат: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Добавление пользователей в чат завершено\n\n"+describeBulkResult(result))
+}
+
+func (b *TelegramBot) cmdAddUsersToGroup(c *commandContext) {
+	result, err := b.db.AddUsersToGroup(c.ctx, c.IDs("user_id"), c.String("group_name"))
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка добавления пользователей в группу: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Добавление пользователей в группу завершено\n\n"+describeBulkResult(result))
+}
+
+// describeBulkResult формирует отчет о массовом добавлении пользователей
+func describeBulkResult(result models.BulkResult) string {
+	lines := []string{fmt.Sprintf("Добавлено: %d", len(result.Added))}
+	if len(result.Existing) > 0 {
+		lines = append(lines, fmt.Sprintf("Уже были добавлены: %s", joinIDs(result.Existing)))
+	}
+	if len(result.Unknown) > 0 {
+		lines = append(lines, fmt.Sprintf("Не найдены: %s", joinIDs(result.Unknown)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinIDs перечисляет ID через запятую
+func joinIDs(ids []int64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (b *TelegramBot) cmdRemoveFromChat(c *commandContext) {
+	if err := b.db.RemoveUserFromChat(c.ctx, c.ID("user_id"), c.ID("chat_id")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления пользователя из чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь удален из чата")
+}
+
+func (b *TelegramBot) cmdRemoveUsersFromChat(c *commandContext) {
+	if err := b.db.RemoveUsersFromChat(c.ctx, c.IDs("user_id"), c.ID("chat_id")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления пользователей из чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователи удалены из чата")
+}
+
+func (b *TelegramBot) cmdRemoveFromGroup(c *commandContext) {
+	if err := b.db.RemoveUserFromGroup(c.ctx, c.ID("user_id"), c.String("group_name")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления пользователя из группы: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователь удален из группы")
+}
+
+func (b *TelegramBot) cmdRemoveUsersFromGroup(c *commandContext) {
+	if err := b.db.RemoveUsersFromGroup(c.ctx, c.IDs("user_id"), c.String("group_name")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка удаления пользователей из группы: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Пользователи удалены из группы")
+}
+
+func (b *TelegramBot) cmdUnlinkGroupChat(c *commandContext) {
+	groupName, chatID := c.String("group_name"), linkTargetChatID(c)
+	linked, err := b.db.GroupLinkedToChat(c.ctx, groupName, chatID)
+	if err != nil {
+		log.Printf("Ошибка проверки привязки группы %s к чату %d: %v", groupName, chatID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if !linked {
+		b.sendText(c.chatID, fmt.Sprintf("Группа %s не привязана к чату %d", groupName, chatID))
+		return
+	}
+	if err := b.db.UnlinkGroupFromChat(c.ctx, groupName, chatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка отвязки группы от чата: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Группа отвязана от чата")
+}
+
+// entityOps описывает восстановление и окончательное удаление сущностей одного типа
+type entityOps struct {
+	perm    Permission
+	restore func(ctx context.Context, id string) error
+	purge   func(ctx context.Context, id string) error
+}
+
+// entityOps возвращает операции для типов сущностей из аргумента /restore и /purge
+func (b *TelegramBot) entityOps() map[string]entityOps {
+	return map[string]entityOps{
+		"user":  {PermManageUsers, withID(b.db.RestoreUser), withID(b.db.PurgeUser)},
+		"chat":  {PermManageChats, withID(b.db.RestoreChat), withID(b.db.PurgeChat)},
+		"group": {PermManageGroups, b.db.RestoreGroup, b.db.PurgeGroup},
+	}
+}
+
+// withID разбирает числовой ID перед вызовом операции
+func withID(op func(ctx context.Context, id int64) error) func(ctx context.Context, id string) error {
+	return func(ctx context.Context, id string) error {
+		value, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return fmt.Errorf("неверный формат id: %s", id)
+		}
+		return op(ctx, value)
+	}
+}
+
+// entityOpsArg возвращает операции для типа сущности из аргументов команды
+// и проверяет право пользователя на управление этим типом
+func (b *TelegramBot) entityOpsArg(c *commandContext) (entityOps, bool) {
+	kind := strings.ToLower(c.String("user|chat|group"))
+	ops, ok := b.entityOps()[kind]
+	if !ok {
+		b.sendText(c.chatID, fmt.Sprintf("Неизвестный тип %s. Допустимые типы: user, chat, group", kind))
+		return entityOps{}, false
+	}
+	return ops, b.requirePermission(c.ctx, c.userID, 0, ops.perm, c.chatID)
+}
+
+func (b *TelegramBot) cmdDeleted(c *commandContext) {
+	users, err := b.db.ListDeletedUsers(c.ctx)
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка получения удаленных пользователей: %v", err))
+		return
+	}
+	chats, err := b.db.ListDeletedChats(c.ctx)
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка получения удаленных чатов: %v", err))
+		return
+	}
+	groups, err := b.db.ListDeletedGroups(c.ctx)
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка получения удаленных групп: %v", err))
+		return
+	}
+	if len(users)+len(chats)+len(groups) == 0 {
+		b.sendText(c.chatID, "Удаленных записей нет")
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("Удаленные записи (восстановить - /restore, удалить окончательно - /purge):\n")
+	for _, user := range users {
+		text.WriteString(fmt.Sprintf("\nuser %d - %s", user.UserID, userLabel(user)))
+	}
+	for _, chat := range chats {
+		text.WriteString(fmt.Sprintf("\nchat %d - %s", chat.ChatID, chat.Title))
+	}
+	for _, group := range groups {
+		text.WriteString(fmt.Sprintf("\ngroup %s", group.Name))
+	}
+	b.sendText(c.chatID, text.String())
+}
+
+func (b *TelegramBot) cmdRestore(c *commandContext) {
+	ops, ok := b.entityOpsArg(c)
+	if !ok {
+		return
+	}
+	if err := ops.restore(c.ctx, c.String("id")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка восстановления: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Запись восстановлена. Связи с чатами и группами нужно добавить заново")
+}
+
+func (b *TelegramBot) cmdPurge(c *commandContext) {
+	ops, ok := b.entityOpsArg(c)
+	if !ok {
+		return
+	}
+	if err := ops.purge(c.ctx, c.String("id")); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка окончательного удаления: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Запись удалена окончательно")
+}
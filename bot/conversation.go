@@ -0,0 +1,457 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// conversationTTL - сколько бот ждет ответа на очередной шаг диалога
+const conversationTTL = 15 * time.Minute
+
+// inputKind - тип значения, которое ожидается на шаге диалога
+type inputKind int
+
+const (
+	// inputText - произвольный текст
+	inputText inputKind = iota
+	// inputUserID - ID числом, пересланное сообщение пользователя или его контакт
+	inputUserID
+	// inputChatID - ID числом или сообщение, пересланное из канала
+	inputChatID
+	// inputConfirm - подтверждение кнопкой
+	inputConfirm
+)
+
+// flowStep описывает шаг диалога
+type flowStep struct {
+	Key      string
+	Prompt   string
+	Input    inputKind
+	Validate func(value string) error
+}
+
+// conversationFlow описывает сценарий пошагового ввода
+type conversationFlow struct {
+	Name       string
+	Permission Permission
+	Steps      []flowStep
+	// Summary формирует текст подтверждения перед выполнением
+	Summary func(data map[string]string) string
+	// Finish выполняет действие и возвращает текст результата
+	Finish func(ctx context.Context, data map[string]string) (string, error)
+	// Done - экран, на который ведет кнопка после завершения
+	Done callback
+	// DoneFor, если задан, выбирает экран по введенным значениям
+	DoneFor func(data map[string]string) callback
+}
+
+// done возвращает экран, на который ведет кнопка после завершения
+func (f *conversationFlow) done(data map[string]string) callback {
+	if f.DoneFor != nil {
+		return f.DoneFor(data)
+	}
+	return f.Done
+}
+
+// newFlows описывает сценарии пошагового ввода
+func (b *TelegramBot) newFlows() map[string]*conversationFlow {
+	flows := []*conversationFlow{
+		{
+			Name:       "create_user",
+			Permission: PermManageUsers,
+			Steps: []flowStep{
+				{Key: "user_id", Input: inputUserID, Prompt: "Отправьте ID пользователя, перешлите его сообщение или поделитесь его контактом."},
+				{Key: "username", Input: inputText, Prompt: "Отправьте username пользователя."},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Создать пользователя?\n\nID: %s\nUsername: %s", data["user_id"], data["username"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				userID, _ := strconv.ParseInt(data["user_id"], 10, 64)
+				if err := b.db.AddUser(ctx, userID, data["username"], data["first_name"], data["last_name"]); err != nil {
+					return "", fmt.Errorf("ошибка добавления пользователя: %v", err)
+				}
+				return "Пользователь успешно добавлен", nil
+			},
+			Done: callback{Action: actUsers, Page: 1},
+		},
+		{
+			Name:       "create_chat",
+			Permission: PermManageChats,
+			Steps: []flowStep{
+				{Key: "chat_id", Input: inputChatID, Prompt: "Отправьте ID чата или перешлите сообщение из канала."},
+				{Key: "title", Input: inputText, Prompt: "Отправьте название чата."},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Создать чат?\n\nID: %s\nНазвание: %s", data["chat_id"], data["title"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				chatID, _ := strconv.ParseInt(data["chat_id"], 10, 64)
+				if err := b.db.AddChat(ctx, chatID, data["title"]); err != nil {
+					return "", fmt.Errorf("ошибка добавления чата: %v", err)
+				}
+				return "Чат успешно добавлен", nil
+			},
+			Done: callback{Action: actChats, Page: 1},
+		},
+		{
+			Name:       "create_group",
+			Permission: PermManageGroups,
+			Steps: []flowStep{
+				{Key: "name", Input: inputText, Prompt: "Отправьте название группы.", Validate: validateGroupName},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Создать группу %s?", data["name"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				if err := b.db.AddGroup(ctx, data["name"]); err != nil {
+					return "", fmt.Errorf("ошибка добавления группы: %v", err)
+				}
+				return "Группа успешно добавлена", nil
+			},
+			Done: callback{Action: actGroups, Page: 1},
+		},
+		{
+			Name:       "rename_user",
+			Permission: PermManageUsers,
+			Steps: []flowStep{
+				{Key: "username", Input: inputText, Prompt: "Отправьте новый username пользователя."},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Изменить username пользователя %s на %s?", data["user_id"], data["username"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				userID, _ := strconv.ParseInt(data["user_id"], 10, 64)
+				if err := b.db.SetUsername(ctx, userID, data["username"]); err != nil {
+					return "", fmt.Errorf("ошибка изменения username: %v", err)
+				}
+				return "Username успешно изменен", nil
+			},
+			DoneFor: func(data map[string]string) callback {
+				userID, _ := strconv.ParseInt(data["user_id"], 10, 64)
+				return callback{Action: actEditUser, UserID: userID}
+			},
+		},
+		{
+			Name:       "rename_chat",
+			Permission: PermManageChats,
+			Steps: []flowStep{
+				{Key: "title", Input: inputText, Prompt: "Отправьте новое название чата."},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Изменить название чата %s на «%s»?", data["chat_id"], data["title"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				chatID, _ := strconv.ParseInt(data["chat_id"], 10, 64)
+				if err := b.db.SetChatTitle(ctx, chatID, data["title"]); err != nil {
+					return "", fmt.Errorf("ошибка изменения названия чата: %v", err)
+				}
+				return "Название чата успешно изменено", nil
+			},
+			DoneFor: func(data map[string]string) callback {
+				chatID, _ := strconv.ParseInt(data["chat_id"], 10, 64)
+				return callback{Action: actEditChat, ChatID: chatID}
+			},
+		},
+		{
+			Name:       "rename_group",
+			Permission: PermManageGroups,
+			Steps: []flowStep{
+				{Key: "name", Input: inputText, Prompt: "Отправьте новое название группы.", Validate: validateGroupName},
+				{Input: inputConfirm},
+			},
+			Summary: func(data map[string]string) string {
+				return fmt.Sprintf("Переименовать группу %s в %s?", data["group"], data["name"])
+			},
+			Finish: func(ctx context.Context, data map[string]string) (string, error) {
+				if err := b.db.RenameGroup(ctx, data["group"], data["name"]); err != nil {
+					return "", fmt.Errorf("ошибка переименования группы: %v", err)
+				}
+				return "Группа успешно переименована", nil
+			},
+			DoneFor: func(data map[string]string) callback {
+				groupID, _ := strconv.ParseUint(data["group_id"], 10, 32)
+				return callback{Action: actEditGroup, GroupID: uint(groupID)}
+			},
+		},
+	}
+
+	result := make(map[string]*conversationFlow, len(flows))
+	for _, flow := range flows {
+		result[flow.Name] = flow
+	}
+	return result
+}
+
+// validateGroupName проверяет, что название группы можно использовать в команде /group
+func validateGroupName(name string) error {
+	if len(strings.Fields(name)) != 1 {
+		return fmt.Errorf("название группы должно быть одним словом без пробелов")
+	}
+	return nil
+}
+
+// conversationData разбирает введенные значения диалога
+func conversationData(conversation *models.Conversation) map[string]string {
+	data := make(map[string]string)
+	if conversation.Data != "" {
+		if err := json.Unmarshal([]byte(conversation.Data), &data); err != nil {
+			log.Printf("Ошибка разбора данных диалога пользователя %d: %v", conversation.UserID, err)
+		}
+	}
+	return data
+}
+
+// saveConversation сохраняет шаг и значения диалога и продлевает срок ожидания
+func (b *TelegramBot) saveConversation(ctx context.Context, conversation *models.Conversation, data map[string]string) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения данных диалога: %v", err)
+	}
+	conversation.Data = string(encoded)
+	conversation.ExpiresAt = time.Now().Add(conversationTTL)
+	return b.db.SaveConversation(ctx, conversation)
+}
+
+// startConversation начинает диалог и показывает первый шаг.
+// data задает известные заранее значения, например ID изменяемого объекта.
+func (b *TelegramBot) startConversation(ctx context.Context, userID int64, chatID int64, flowName string, data map[string]string, update *tgbotapi.Update) error {
+	flow := b.flows[flowName]
+	conversation := &models.Conversation{UserID: userID, ChatID: chatID, Flow: flowName}
+	if data == nil {
+		data = make(map[string]string)
+	}
+	if err := b.saveConversation(ctx, conversation, data); err != nil {
+		return err
+	}
+	b.promptStep(conversation, flow, data, update)
+	return nil
+}
+
+// activeConversation возвращает незавершенный диалог пользователя. Истекший диалог удаляется.
+func (b *TelegramBot) activeConversation(ctx context.Context, userID int64) (*models.Conversation, *conversationFlow, bool, error) {
+	conversation, ok, err := b.db.GetConversation(ctx, userID)
+	if err != nil || !ok {
+		return nil, nil, false, err
+	}
+	flow, known := b.flows[conversation.Flow]
+	if !known || conversation.Step >= len(flow.Steps) || conversation.Expired(time.Now()) {
+		if err := b.db.DeleteConversation(ctx, userID); err != nil {
+			log.Printf("Ошибка удаления диалога пользователя %d: %v", userID, err)
+		}
+		return conversation, nil, false, nil
+	}
+	return conversation, flow, true, nil
+}
+
+// promptStep показывает текущий шаг диалога с кнопками навигации
+func (b *TelegramBot) promptStep(conversation *models.Conversation, flow *conversationFlow, data map[string]string, update *tgbotapi.Update) {
+	step := flow.Steps[conversation.Step]
+
+	text := step.Prompt
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if step.Input == inputConfirm {
+		text = flow.Summary(data)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(b.button("✅ Подтвердить", callback{Action: actConvConfirm})))
+	} else if value := data[step.Key]; value != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(b.button(fmt.Sprintf("Оставить «%s»", value), callback{Action: actConvSkip})))
+	}
+
+	var navigation []tgbotapi.InlineKeyboardButton
+	if conversation.Step > 0 {
+		navigation = append(navigation, b.button("◀️ Назад", callback{Action: actConvBack}))
+	}
+	navigation = append(navigation, b.button("✖️ Отмена", callback{Action: actConvCancel}))
+	rows = append(rows, navigation)
+
+	msg := tgbotapi.NewMessage(conversation.ChatID, fmt.Sprintf("Шаг %d из %d\n\n%s", conversation.Step+1, len(flow.Steps), text))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.render(msg, update)
+}
+
+// HandleMessage принимает ответ пользователя на текущий шаг диалога.
+// Сообщения вне диалога игнорируются.
+func (b *TelegramBot) HandleMessage(ctx context.Context, update tgbotapi.Update) {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return
+	}
+
+	conversation, flow, ok, err := b.activeConversation(ctx, msg.From.ID)
+	if err != nil {
+		log.Printf("Ошибка получения диалога пользователя %d: %v", msg.From.ID, err)
+		return
+	}
+	if conversation == nil || conversation.ChatID != msg.Chat.ID {
+		return
+	}
+	if !ok {
+		b.sendText(msg.Chat.ID, "Время ожидания ввода истекло. Начните заново из админ-панели.")
+		return
+	}
+
+	data := conversationData(conversation)
+	step := flow.Steps[conversation.Step]
+	if step.Input == inputConfirm {
+		b.promptStep(conversation, flow, data, nil)
+		return
+	}
+
+	values, err := parseStepInput(step, msg)
+	if err == nil && step.Validate != nil {
+		err = step.Validate(values[step.Key])
+	}
+	if err != nil {
+		b.sendText(msg.Chat.ID, fmt.Sprintf("%v", err))
+		b.promptStep(conversation, flow, data, nil)
+		return
+	}
+
+	for key, value := range values {
+		data[key] = value
+	}
+	conversation.Step++
+	if err := b.saveConversation(ctx, conversation, data); err != nil {
+		b.sendText(msg.Chat.ID, fmt.Sprintf("Ошибка сохранения ввода: %v", err))
+		return
+	}
+	b.promptStep(conversation, flow, data, nil)
+}
+
+// parseStepInput извлекает значения шага из сообщения. Кроме значения самого шага
+// могут вернуться подсказки для следующих шагов (например, username из пересланного сообщения).
+func parseStepInput(step flowStep, msg *tgbotapi.Message) (map[string]string, error) {
+	values := make(map[string]string)
+	text := strings.TrimSpace(msg.Text)
+
+	switch step.Input {
+	case inputUserID:
+		switch {
+		case msg.Contact != nil:
+			if msg.Contact.UserID == 0 {
+				return nil, fmt.Errorf("Этот контакт не зарегистрирован в Telegram. Отправьте ID вручную.")
+			}
+			values[step.Key] = strconv.FormatInt(msg.Contact.UserID, 10)
+			values["first_name"], values["last_name"] = msg.Contact.FirstName, msg.Contact.LastName
+		case msg.ForwardFrom != nil:
+			values[step.Key] = strconv.FormatInt(msg.ForwardFrom.ID, 10)
+			values["username"] = msg.ForwardFrom.UserName
+			values["first_name"], values["last_name"] = msg.ForwardFrom.FirstName, msg.ForwardFrom.LastName
+		case msg.ForwardSenderName != "":
+			return nil, fmt.Errorf("Пользователь скрыл свой аккаунт в пересланных сообщениях. Отправьте ID вручную или поделитесь контактом.")
+		default:
+			if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+				return nil, fmt.Errorf("Неверный формат user_id")
+			}
+			values[step.Key] = text
+		}
+
+	case inputChatID:
+		if msg.ForwardFromChat != nil {
+			values[step.Key] = strconv.FormatInt(msg.ForwardFromChat.ID, 10)
+			values["title"] = msg.ForwardFromChat.Title
+			break
+		}
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return nil, fmt.Errorf("Неверный формат chat_id")
+		}
+		values[step.Key] = text
+
+	default:
+		if text == "" {
+			return nil, fmt.Errorf("Отправьте текстовое сообщение.")
+		}
+		values[step.Key] = strings.TrimPrefix(text, "@")
+	}
+	return values, nil
+}
+
+// handleConversationCallback обрабатывает кнопки навигации по диалогу
+func (b *TelegramBot) handleConversationCallback(ctx context.Context, cb callback, update *tgbotapi.Update) callbackNotice {
+	query := update.CallbackQuery
+	conversation, flow, ok, err := b.activeConversation(ctx, query.From.ID)
+	if err != nil {
+		log.Printf("Ошибка получения диалога пользователя %d: %v", query.From.ID, err)
+		return alert(dbErrorText)
+	}
+	if !ok || conversation.ChatID != query.Message.Chat.ID {
+		return alert("Ввод уже завершен или время ожидания истекло.")
+	}
+	data := conversationData(conversation)
+	step := flow.Steps[conversation.Step]
+
+	switch cb.Action {
+	case actConvCancel:
+		if err := b.db.DeleteConversation(ctx, conversation.UserID); err != nil {
+			return alert(fmt.Sprintf("Ошибка отмены ввода: %v", err))
+		}
+		b.showPrompt(conversation.ChatID, "Ввод отменен.", flow.done(data), update)
+		return toast("Ввод отменен")
+
+	case actConvBack:
+		if conversation.Step > 0 {
+			conversation.Step--
+		}
+
+	case actConvSkip:
+		if step.Input == inputConfirm || data[step.Key] == "" {
+			return alert("Этот шаг нельзя пропустить.")
+		}
+		conversation.Step++
+
+	case actConvConfirm:
+		if step.Input != inputConfirm {
+			return alert("Сначала заполните все шаги.")
+		}
+		if !b.HasPermission(ctx, query.From.ID, 0, flow.Permission) {
+			return alert("У вас нет доступа к этой функции.")
+		}
+		result, err := flow.Finish(ctx, data)
+		if err != nil {
+			return alert(err.Error())
+		}
+		if err := b.db.DeleteConversation(ctx, conversation.UserID); err != nil {
+			log.Printf("Ошибка удаления диалога пользователя %d: %v", conversation.UserID, err)
+		}
+		b.showPrompt(conversation.ChatID, result, flow.done(data), update)
+		return toast(result)
+	}
+
+	if err := b.saveConversation(ctx, conversation, data); err != nil {
+		return alert(fmt.Sprintf("Ошибка сохранения ввода: %v", err))
+	}
+	b.promptStep(conversation, flow, data, update)
+	return callbackNotice{}
+}
+
+// cmdCancel отменяет текущий пошаговый ввод
+func (b *TelegramBot) cmdCancel(c *commandContext) {
+	_, ok, err := b.db.GetConversation(c.ctx, c.userID)
+	if err != nil {
+		log.Printf("Ошибка получения диалога пользователя %d: %v", c.userID, err)
+		b.sendText(c.chatID, dbErrorText)
+		return
+	}
+	if !ok {
+		b.sendText(c.chatID, "Нет активного ввода.")
+		return
+	}
+	if err := b.db.DeleteConversation(c.ctx, c.userID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка отмены ввода: %v", err))
+		return
+	}
+	b.sendText(c.chatID, "Ввод отменен.")
+}
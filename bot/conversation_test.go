@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageUpdate создает обычное сообщение в групповом чате testChatID
+func messageUpdate(userID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			From: &tgbotapi.User{ID: userID},
+			Chat: &tgbotapi.Chat{ID: testChatID, Type: "group"},
+			Text: text,
+		},
+	}
+}
+
+// pressButton нажимает кнопку с callback в групповом чате testChatID
+func pressButton(b *TelegramBot, userID int64, cb callback) {
+	b.HandleCallbackQuery(testCtx, callbackUpdate(userID, encodeCallback(cb)))
+}
+
+func TestCreateGroupConversation(t *testing.T) {
+	b, api, db := newTestBot()
+
+	pressButton(b, testAdminID, callback{Action: actCreateGroup})
+	if db.dialog(testAdminID) == nil {
+		t.Fatal("диалог не начат")
+	}
+
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "two words"))
+	if text := api.texts()[0]; !strings.Contains(text, "без пробелов") {
+		t.Errorf("ожидалась ошибка валидации, получено %q", text)
+	}
+
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "team"))
+	if text := lastText(t, api); !strings.Contains(text, "Создать группу team?") {
+		t.Fatalf("ожидалось подтверждение, получено %q", text)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actConvConfirm})
+	if !db.hasGroup("team") {
+		t.Error("группа не создана")
+	}
+	if db.dialog(testAdminID) != nil {
+		t.Error("диалог не завершен")
+	}
+}
+
+func TestCreateUserConversationFromForward(t *testing.T) {
+	b, api, db := newTestBot()
+	pressButton(b, testAdminID, callback{Action: actCreateUser})
+
+	forward := messageUpdate(testAdminID, "привет")
+	forward.Message.ForwardFrom = &tgbotapi.User{ID: 555, UserName: "forwarded", FirstName: "Имя"}
+	b.HandleMessage(testCtx, forward)
+
+	// username подставлен из пересланного сообщения, шаг можно пропустить
+	pressButton(b, testAdminID, callback{Action: actConvSkip})
+	if answer := lastAnswer(t, api); answer.ShowAlert {
+		t.Fatalf("шаг не пропущен: %q", answer.Text)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actConvConfirm})
+	user, err := db.GetUser(testCtx, 555)
+	if err != nil || user.Username != "forwarded" || user.FirstName != "Имя" {
+		t.Errorf("пользователь создан неверно: %+v, %v", user, err)
+	}
+}
+
+func TestRenameGroupConversation(t *testing.T) {
+	b, api, db := newTestBot()
+	if err := db.AddGroup(testCtx, "team"); err != nil {
+		t.Fatal(err)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actRenameGroup, GroupID: db.groupID("team")})
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "crew"))
+	if text := lastText(t, api); !strings.Contains(text, "Переименовать группу team в crew?") {
+		t.Fatalf("ожидалось подтверждение, получено %q", text)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actConvConfirm})
+	if db.hasGroup("team") || !db.hasGroup("crew") {
+		t.Error("группа не переименована")
+	}
+}
+
+func TestRenameUserAndChatConversation(t *testing.T) {
+	b, _, db := newTestBot()
+	if err := db.AddUser(testCtx, 555, "old", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddChat(testCtx, testTargetID, "Старое"); err != nil {
+		t.Fatal(err)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actRenameUser, UserID: 555})
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "@new"))
+	pressButton(b, testAdminID, callback{Action: actConvConfirm})
+	if user, err := db.GetUser(testCtx, 555); err != nil || user.Username != "new" {
+		t.Errorf("username не изменен: %+v, %v", user, err)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actRenameChat, ChatID: testTargetID})
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "Новое название"))
+	pressButton(b, testAdminID, callback{Action: actConvConfirm})
+	if chat, err := db.GetChat(testCtx, testTargetID); err != nil || chat.Title != "Новое название" {
+		t.Errorf("название чата не изменено: %+v, %v", chat, err)
+	}
+}
+
+func TestConversationBackAndCancel(t *testing.T) {
+	b, _, db := newTestBot()
+	pressButton(b, testAdminID, callback{Action: actCreateChat})
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "-300"))
+	if db.dialog(testAdminID).Step != 1 {
+		t.Fatalf("ожидался шаг 1, текущий %d", db.dialog(testAdminID).Step)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actConvBack})
+	if db.dialog(testAdminID).Step != 0 {
+		t.Errorf("назад не сработало, текущий шаг %d", db.dialog(testAdminID).Step)
+	}
+
+	pressButton(b, testAdminID, callback{Action: actConvCancel})
+	if db.dialog(testAdminID) != nil {
+		t.Error("диалог не отменен")
+	}
+}
+
+func TestConversationExpires(t *testing.T) {
+	b, api, db := newTestBot()
+	pressButton(b, testAdminID, callback{Action: actCreateGroup})
+
+	conversation := db.dialog(testAdminID)
+	conversation.ExpiresAt = time.Now().Add(-time.Minute)
+	db.SaveConversation(testCtx, conversation)
+
+	b.HandleMessage(testCtx, messageUpdate(testAdminID, "team"))
+	if text := lastText(t, api); !strings.HasPrefix(text, "Время ожидания ввода истекло") {
+		t.Errorf("неожиданный ответ: %q", text)
+	}
+	if db.hasGroup("team") {
+		t.Error("ввод принят после истечения срока")
+	}
+}
@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cooldown задает ограничение частоты использования команды
+type Cooldown struct {
+	// PerChat - минимальный интервал между вызовами команды в одном чате
+	PerChat time.Duration
+	// PerUser - минимальный интервал между вызовами команды одним пользователем в чате
+	PerUser time.Duration
+}
+
+// SetCooldown задает ограничение частоты для команды.
+// Пользователи с правом PermBypassCooldown ограничениям не подчиняются.
+func (b *TelegramBot) SetCooldown(command string, cooldown Cooldown) {
+	if b.cooldowns == nil {
+		b.cooldowns = make(map[string]Cooldown)
+	}
+	b.cooldowns[command] = cooldown
+}
+
+// cooldownUntil возвращает время, до которого команда недоступна в чате для пользователя.
+// Если команду можно выполнить сейчас, возвращается false.
+func (b *TelegramBot) cooldownUntil(ctx context.Context, command string, chatID, userID int64, now time.Time) (time.Time, bool) {
+	cooldown, ok := b.cooldowns[command]
+	if !ok || b.HasPermission(ctx, userID, chatID, PermBypassCooldown) {
+		return time.Time{}, false
+	}
+
+	var until time.Time
+	if cooldown.PerChat > 0 {
+		if t, ok := b.lastCommandUse(ctx, command, chatID, 0); ok {
+			if t = t.Add(cooldown.PerChat); t.After(until) {
+				until = t
+			}
+		}
+	}
+	if cooldown.PerUser > 0 {
+		if t, ok := b.lastCommandUse(ctx, command, chatID, userID); ok {
+			if t = t.Add(cooldown.PerUser); t.After(until) {
+				until = t
+			}
+		}
+	}
+
+	if until.After(now) {
+		return until, true
+	}
+	return time.Time{}, false
+}
+
+// lastCommandUse возвращает время последнего использования команды.
+// Ошибка базы только логируется: ограничение частоты не должно блокировать команды.
+func (b *TelegramBot) lastCommandUse(ctx context.Context, command string, chatID, userID int64) (time.Time, bool) {
+	last, ok, err := b.db.GetLastCommandUse(ctx, command, chatID, userID)
+	if err != nil {
+		log.Printf("Ошибка получения использования команды %s в чате %d: %v", command, chatID, err)
+		return time.Time{}, false
+	}
+	return last, ok
+}
+
+// checkCooldown проверяет ограничение частоты и сообщает пользователю, когда команда станет доступна.
+// Возвращает true, если команду можно выполнять.
+func (b *TelegramBot) checkCooldown(ctx context.Context, command string, chatID, userID int64) bool {
+	until, limited := b.cooldownUntil(ctx, command, chatID, userID, time.Now())
+	if !limited {
+		return true
+	}
+
+	wait := time.Until(until).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Команда /%s будет доступна в %s (через %s).",
+		command, until.Format("15:04:05"), formatWait(wait)))
+	b.bot.Send(msg)
+	return false
+}
+
+// recordCooldown сохраняет использование команды для чата и пользователя
+func (b *TelegramBot) recordCooldown(ctx context.Context, command string, chatID, userID int64) {
+	if _, ok := b.cooldowns[command]; !ok {
+		return
+	}
+	now := time.Now()
+	if err := b.db.RecordCommandUse(ctx, command, chatID, 0, now); err != nil {
+		log.Printf("Ошибка сохранения использования команды: %v", err)
+	}
+	if err := b.db.RecordCommandUse(ctx, command, chatID, userID, now); err != nil {
+		log.Printf("Ошибка сохранения использования команды: %v", err)
+	}
+}
+
+// formatWait форматирует время ожидания в виде "5 мин. 10 сек."
+func formatWait(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	seconds := int((d % time.Minute) / time.Second)
+	switch {
+	case minutes > 0 && seconds > 0:
+		return fmt.Sprintf("%d мин. %d сек.", minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%d мин.", minutes)
+	default:
+		return fmt.Sprintf("%d сек.", seconds)
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"weveryone_bot_v2/models"
+)
+
+func TestCooldownUntil(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		// chatUse и userUse - сколько времени назад команду вызывали в чате и этот пользователь (0 - не вызывали)
+		chatUse, userUse time.Duration
+		cooldown         Cooldown
+		want             time.Duration
+	}{
+		{"без вызовов", 0, 0, Cooldown{PerChat: 10 * time.Minute, PerUser: 30 * time.Minute}, 0},
+		{"ограничение чата", 5 * time.Minute, 0, Cooldown{PerChat: 10 * time.Minute, PerUser: 30 * time.Minute}, 5 * time.Minute},
+		{"ограничение пользователя дольше", 5 * time.Minute, 5 * time.Minute, Cooldown{PerChat: 10 * time.Minute, PerUser: 30 * time.Minute}, 25 * time.Minute},
+		{"ограничение чата дольше", time.Minute, 29 * time.Minute, Cooldown{PerChat: 10 * time.Minute, PerUser: 30 * time.Minute}, 9 * time.Minute},
+		{"оба истекли", 40 * time.Minute, 40 * time.Minute, Cooldown{PerChat: 10 * time.Minute, PerUser: 30 * time.Minute}, 0},
+		{"только чат", time.Minute, time.Minute, Cooldown{PerChat: 10 * time.Minute}, 9 * time.Minute},
+		{"только пользователь", time.Minute, time.Minute, Cooldown{PerUser: 10 * time.Minute}, 9 * time.Minute},
+		{"ровно на границе", 10 * time.Minute, 0, Cooldown{PerChat: 10 * time.Minute}, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, _, db := newTestBot()
+			b.SetCooldown("all", tc.cooldown)
+			if tc.chatUse > 0 {
+				db.RecordCommandUse(testCtx, "all", testTargetID, 0, now.Add(-tc.chatUse))
+			}
+			if tc.userUse > 0 {
+				db.RecordCommandUse(testCtx, "all", testTargetID, testUserID, now.Add(-tc.userUse))
+			}
+
+			until, limited := b.cooldownUntil(testCtx, "all", testTargetID, testUserID, now)
+			if limited != (tc.want > 0) {
+				t.Fatalf("ограничение %v, ожидалось %v", limited, tc.want > 0)
+			}
+			if limited && !until.Equal(now.Add(tc.want)) {
+				t.Errorf("команда доступна с %s, ожидалось %s", until.Format("15:04"), now.Add(tc.want).Format("15:04"))
+			}
+		})
+	}
+}
+
+func TestCooldownBypass(t *testing.T) {
+	now := time.Now()
+	b, _, db := newTestBot()
+	b.SetCooldown("all", Cooldown{PerChat: time.Hour})
+	db.RecordCommandUse(testCtx, "all", testTargetID, 0, now)
+
+	if _, limited := b.cooldownUntil(testCtx, "other", testTargetID, testUserID, now); limited {
+		t.Error("ограничена команда без настроенного ограничения")
+	}
+	if _, limited := b.cooldownUntil(testCtx, "all", testTargetID, testAdminID, now); limited {
+		t.Error("владелец бота подчиняется ограничению частоты")
+	}
+
+	// Менеджер обходит ограничение только в своем чате
+	db.AddChat(testCtx, -400, "other")
+	db.GrantRole(testCtx, testUserID, models.RoleManager, -400)
+	if _, limited := b.cooldownUntil(testCtx, "all", testTargetID, testUserID, now); !limited {
+		t.Error("менеджер другого чата обошел ограничение")
+	}
+	db.AddChat(testCtx, testTargetID, "target")
+	db.GrantRole(testCtx, testUserID, models.RoleManager, testTargetID)
+	if _, limited := b.cooldownUntil(testCtx, "all", testTargetID, testUserID, now); limited {
+		t.Error("менеджер чата подчиняется ограничению частоты")
+	}
+}
+
+// TestCooldownSurvivesRestart проверяет, что ограничение хранится в базе и действует после перезапуска бота
+func TestCooldownSurvivesRestart(t *testing.T) {
+	first, _, db := newTestBot()
+	first.SetCooldown("all", Cooldown{PerUser: time.Hour})
+	first.recordCooldown(testCtx, "all", testTargetID, testUserID)
+
+	restarted, api, _ := newTestBot()
+	restarted.db = db
+	restarted.SetCooldown("all", Cooldown{PerUser: time.Hour})
+	if restarted.checkCooldown(testCtx, "all", testTargetID, testUserID) {
+		t.Fatal("ограничение частоты потеряно после перезапуска")
+	}
+	if text := lastText(t, api); !strings.Contains(text, "/all будет доступна") {
+		t.Errorf("неожиданное сообщение: %q", text)
+	}
+	if !restarted.checkCooldown(testCtx, "all", testTargetID, testUserID+1) {
+		t.Error("ограничение пользователя распространилось на другого пользователя")
+	}
+}
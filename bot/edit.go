@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// showPrompt показывает подсказку с командой, которую нужно отправить, и кнопкой возврата
+func (b *TelegramBot) showPrompt(chatID int64, text string, back callback, update *tgbotapi.Update) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("Назад", back),
+		),
+	)
+	b.render(msg, update)
+}
+
+// ShowUserEdit показывает редактирование пользователя: смену username и исключение из чатов и групп
+func (b *TelegramBot) ShowUserEdit(ctx context.Context, chatID int64, userID int64, update *tgbotapi.Update) {
+	user, err := b.db.GetUser(ctx, userID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "Ошибка получения информации о пользователе")
+		b.render(msg, update)
+		return
+	}
+
+	back := callback{Action: actUserInfo, UserID: userID}
+	chats, err := b.db.GetChatsForUser(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "чаты пользователя", err, back, update)
+		return
+	}
+	groups, err := b.db.GetGroupsForUser(ctx, userID)
+	if err != nil {
+		b.renderLoadError(chatID, "группы пользователя", err, back, update)
+		return
+	}
+
+	text := fmt.Sprintf("Редактирование пользователя %s\n", userLabel(*user))
+	if len(chats) > 0 || len(groups) > 0 {
+		text += "\nНажмите на чат или группу, чтобы исключить из нее пользователя."
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		{b.button("✏️ Изменить username", callback{Action: actRenameUser, UserID: userID})},
+	}
+	for _, chat := range chats {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.button(fmt.Sprintf("➖ 💬 %s", chat.Title), callback{Action: actUserLeaveChat, UserID: userID, ChatID: chat.ChatID}),
+		))
+	}
+	for _, group := range groups {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.button(fmt.Sprintf("➖ 👥 %s", group.Name), callback{Action: actUserLeaveGroup, UserID: userID, GroupID: group.ID}),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		b.button("Назад", callback{Action: actUserInfo, UserID: userID}),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	b.render(msg, update)
+}
+
+// ShowChatEdit показывает редактирование чата
+func (b *TelegramBot) ShowChatEdit(ctx context.Context, chatID int64, targetChatID int64, update *tgbotapi.Update) {
+	chat, err := b.db.GetChat(ctx, targetChatID)
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatID, "Ошибка получения информации о чате")
+		b.render(msg, update)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Редактирование чата %s (%d)", chat.Title, chat.ChatID))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("✏️ Изменить название", callback{Action: actRenameChat, ChatID: targetChatID}),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("Назад", callback{Action: actChatInfo, ChatID: targetChatID}),
+		),
+	)
+	b.render(msg, update)
+}
+
+// ShowGroupEdit показывает редактирование группы
+func (b *TelegramBot) ShowGroupEdit(ctx context.Context, chatID int64, groupID uint, update *tgbotapi.Update) {
+	group, ok := b.loadGroup(ctx, chatID, groupID, callback{Action: actGroups, Page: 1}, update)
+	if !ok {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Редактирование группы %s", group.Name))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("✏️ Переименовать", callback{Action: actRenameGroup, GroupID: groupID}),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("Назад", callback{Action: actGroupInfo, GroupID: groupID}),
+		),
+	)
+	b.render(msg, update)
+}
+
+// loadGroup загружает группу для экрана админки. Если группы нет или база недоступна,
+// показывает сообщение с кнопкой back и возвращает false.
+func (b *TelegramBot) loadGroup(ctx context.Context, chatID int64, groupID uint, back callback, update *tgbotapi.Update) (*models.Group, bool) {
+	group, found, err := b.db.GetGroupByID(ctx, groupID)
+	if err != nil {
+		b.renderLoadError(chatID, "группу", err, back, update)
+		return nil, false
+	}
+	if !found {
+		msg := tgbotapi.NewMessage(chatID, "Группа не найдена")
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				b.button("Назад", back),
+			),
+		)
+		b.render(msg, update)
+		return nil, false
+	}
+	return group, true
+}
+
+// maxRemoveButtons ограничивает число кнопок удаления участников на одном экране
+const maxRemoveButtons = 50
+
+// removeButtons создает по кнопке удаления на каждого участника (не больше maxRemoveButtons)
+func (b *TelegramBot) removeButtons(users []models.User, action func(user models.User) callback) [][]tgbotapi.InlineKeyboardButton {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, user := range users {
+		if i == maxRemoveButtons {
+			break
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			b.button(fmt.Sprintf("➖ %s", userLabel(user)), action(user)),
+		))
+	}
+	return rows
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"weveryone_bot_v2/database/dbtest"
+	"weveryone_bot_v2/models"
+)
+
+// fakeDB - база в памяти для тестов бота. Методы чтения, ошибки которых бот
+// показывает пользователю, возвращают readErr, если он задан.
+type fakeDB struct {
+	*dbtest.MemoryDB
+	// readErr имитирует ошибку базы при чтении
+	readErr error
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{MemoryDB: dbtest.NewMemoryDB()}
+}
+
+func (f *fakeDB) ListUsers(ctx context.Context) ([]models.User, error) {
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+	return f.MemoryDB.ListUsers(ctx)
+}
+
+func (f *fakeDB) GetUsersForMention(ctx context.Context, chatID int64, groupName string) ([]models.User, error) {
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+	return f.MemoryDB.GetUsersForMention(ctx, chatID, groupName)
+}
+
+func (f *fakeDB) GroupExists(ctx context.Context, name string) (bool, error) {
+	if f.readErr != nil {
+		return false, f.readErr
+	}
+	return f.MemoryDB.GroupExists(ctx, name)
+}
+
+func (f *fakeDB) GetConversation(ctx context.Context, userID int64) (*models.Conversation, bool, error) {
+	if f.readErr != nil {
+		return nil, false, f.readErr
+	}
+	return f.MemoryDB.GetConversation(ctx, userID)
+}
+
+// Проверки состояния базы в тестах не зависят от readErr
+
+func (f *fakeDB) hasUser(userID int64) bool {
+	ok, _ := f.MemoryDB.UserExists(testCtx, userID)
+	return ok
+}
+
+func (f *fakeDB) hasChat(chatID int64) bool {
+	ok, _ := f.MemoryDB.ChatExists(testCtx, chatID)
+	return ok
+}
+
+func (f *fakeDB) hasGroup(name string) bool {
+	ok, _ := f.MemoryDB.GroupExists(testCtx, name)
+	return ok
+}
+
+// groupID возвращает ID группы для кнопок
+func (f *fakeDB) groupID(name string) uint {
+	group, err := f.MemoryDB.GetGroup(testCtx, name)
+	if err != nil {
+		return 0
+	}
+	return group.ID
+}
+
+func (f *fakeDB) linked(groupName string, chatID int64) bool {
+	ok, _ := f.MemoryDB.GroupLinkedToChat(testCtx, groupName, chatID)
+	return ok
+}
+
+func (f *fakeDB) inChat(userID, chatID int64) bool {
+	users, _ := f.MemoryDB.GetUsersForChat(testCtx, chatID)
+	return containsUser(users, userID)
+}
+
+func (f *fakeDB) inGroup(userID int64, groupName string) bool {
+	users, _ := f.MemoryDB.GetUsersForGroup(testCtx, groupName)
+	return containsUser(users, userID)
+}
+
+// dialog возвращает незавершенный диалог пользователя или nil
+func (f *fakeDB) dialog(userID int64) *models.Conversation {
+	conversation, _, _ := f.MemoryDB.GetConversation(testCtx, userID)
+	return conversation
+}
+
+func containsUser(users []models.User, userID int64) bool {
+	for _, user := range users {
+		if user.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"strings"
+	"unicode/utf16"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// utf16Len возвращает длину строки в кодовых единицах UTF-16,
+// в которых Telegram считает смещения сущностей
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// userLabel возвращает подпись пользователя: @username или отображаемое имя
+func userLabel(user models.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return user.DisplayName()
+}
+
+// userLabels возвращает подписи для списка пользователей
+func userLabels(users []models.User) []string {
+	labels := make([]string, 0, len(users))
+	for _, user := range users {
+		labels = append(labels, userLabel(user))
+	}
+	return labels
+}
+
+// buildMentions формирует текст упоминаний и сущности для него.
+// Пользователи с username упоминаются через @username, остальные - через text_mention.
+func buildMentions(users []models.User) (string, []tgbotapi.MessageEntity) {
+	var text strings.Builder
+	var entities []tgbotapi.MessageEntity
+	offset := 0
+
+	for i, user := range users {
+		if i > 0 {
+			text.WriteString(" ")
+			offset++
+		}
+
+		label := userLabel(user)
+		entity := tgbotapi.MessageEntity{
+			Type:   "mention",
+			Offset: offset,
+			Length: utf16Len(label),
+		}
+		if user.Username == "" {
+			entity.Type = "text_mention"
+			entity.User = &tgbotapi.User{
+				ID:        user.UserID,
+				FirstName: user.DisplayName(),
+			}
+		}
+
+		text.WriteString(label)
+		entities = append(entities, entity)
+		offset += entity.Length
+	}
+
+	return text.String(), entities
+}
+
+// newMentionMessage создает сообщение с упоминанием пользователей
+func newMentionMessage(chatID int64, users []models.User) tgbotapi.MessageConfig {
+	text, entities := buildMentions(users)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.Entities = entities
+	return msg
+}
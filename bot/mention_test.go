@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"testing"
+	"unicode/utf16"
+	"weveryone_bot_v2/models"
+)
+
+func TestBuildMentions(t *testing.T) {
+	cases := []struct {
+		name     string
+		users    []models.User
+		wantText string
+		wantType []string
+	}{
+		{
+			name:     "username",
+			users:    []models.User{{UserID: 1, Username: "alice"}, {UserID: 2, Username: "bob"}},
+			wantText: "@alice @bob",
+			wantType: []string{"mention", "mention"},
+		},
+		{
+			name:     "без username",
+			users:    []models.User{{UserID: 1, FirstName: "Иван", LastName: "Петров"}, {UserID: 2, Username: "bob"}},
+			wantText: "Иван Петров @bob",
+			wantType: []string{"text_mention", "mention"},
+		},
+		{
+			name:     "эмодзи в имени",
+			users:    []models.User{{UserID: 1, FirstName: "🎉Аня🎉"}, {UserID: 2, FirstName: "Bob"}, {UserID: 3, Username: "carol"}},
+			wantText: "🎉Аня🎉 Bob @carol",
+			wantType: []string{"text_mention", "text_mention", "mention"},
+		},
+		{
+			name:     "только id",
+			users:    []models.User{{UserID: 42}},
+			wantText: "id42",
+			wantType: []string{"text_mention"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, entities := buildMentions(tc.users)
+			if text != tc.wantText {
+				t.Errorf("текст %q, ожидался %q", text, tc.wantText)
+			}
+			if len(entities) != len(tc.users) {
+				t.Fatalf("сущностей %d, ожидалось %d", len(entities), len(tc.users))
+			}
+
+			// Смещения считаются в UTF-16: вырезанный по ним текст совпадает с подписью пользователя
+			units := utf16.Encode([]rune(text))
+			for i, entity := range entities {
+				if entity.Type != tc.wantType[i] {
+					t.Errorf("сущность %d: тип %s, ожидался %s", i, entity.Type, tc.wantType[i])
+				}
+				if entity.Offset+entity.Length > len(units) {
+					t.Fatalf("сущность %d выходит за пределы текста: %+v", i, entity)
+				}
+				got := string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+				if want := userLabel(tc.users[i]); got != want {
+					t.Errorf("сущность %d указывает на %q, ожидалось %q", i, got, want)
+				}
+				if entity.Type == "text_mention" && (entity.User == nil || entity.User.ID != tc.users[i].UserID) {
+					t.Errorf("сущность %d ссылается на пользователя %+v", i, entity.User)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// rolesAllow возвращает проверку прав для набора ролей
+func rolesAllow(roles []models.UserRole) func(Permission) bool {
+	return func(perm Permission) bool {
+		for _, role := range roles {
+			if roleHasPermission(role.Role, perm) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// menuLanguages возвращает языки меню: "" - язык по умолчанию и переводы из описаний команд
+func (b *TelegramBot) menuLanguages() []string {
+	return append([]string{""}, b.commands.languages()...)
+}
+
+// publishMenu публикует меню команд для области видимости на всех языках
+func (b *TelegramBot) publishMenu(scope tgbotapi.BotCommandScope, allowed func(Permission) bool) error {
+	for _, lang := range b.menuLanguages() {
+		config := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(scope, lang, b.commands.botCommands(lang, allowed)...)
+		if _, err := b.bot.Request(config); err != nil {
+			return fmt.Errorf("ошибка публикации меню команд (%s, %q): %v", scope.Type, lang, err)
+		}
+	}
+	return nil
+}
+
+// deleteMenu удаляет меню команд области видимости, после чего Telegram показывает меню более общей области
+func (b *TelegramBot) deleteMenu(scope tgbotapi.BotCommandScope) error {
+	for _, lang := range b.menuLanguages() {
+		config := tgbotapi.NewDeleteMyCommandsWithScopeAndLanguage(scope, lang)
+		if _, err := b.bot.Request(config); err != nil {
+			return fmt.Errorf("ошибка удаления меню команд (%s, %q): %v", scope.Type, lang, err)
+		}
+	}
+	return nil
+}
+
+// RegisterCommands публикует меню команд для всех областей видимости:
+// общее, групповые чаты, администраторы чатов и пользователи с ролями
+func (b *TelegramBot) RegisterCommands(ctx context.Context) error {
+	managerRoles := []models.UserRole{{Role: models.RoleManager}}
+	scopes := []struct {
+		scope   tgbotapi.BotCommandScope
+		allowed func(Permission) bool
+	}{
+		{tgbotapi.NewBotCommandScopeDefault(), nil},
+		{tgbotapi.NewBotCommandScopeAllGroupChats(), nil},
+		// Администраторы чатов в Telegram получают права менеджера своего чата
+		{tgbotapi.NewBotCommandScopeAllChatAdministrators(), rolesAllow(managerRoles)},
+	}
+	for _, s := range scopes {
+		if err := b.publishMenu(s.scope, s.allowed); err != nil {
+			return err
+		}
+	}
+
+	roles, err := b.db.ListRoles(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения ролей для меню команд: %v", err)
+	}
+	users := map[int64]bool{b.adminID: true}
+	for _, role := range roles {
+		users[role.UserID] = true
+	}
+	// Ошибка для одного пользователя не должна оставлять без меню остальных
+	failed := 0
+	for userID := range users {
+		if err := b.publishUserMenus(ctx, userID); err != nil {
+			log.Printf("Ошибка публикации меню команд пользователя %d: %v", userID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось опубликовать меню команд для %d из %d пользователей", failed, len(users))
+	}
+	return nil
+}
+
+// publishUserMenus публикует меню пользователя по его ролям: в личном чате с ботом - по глобальным ролям,
+// в чатах с ролью менеджера - по ролям в этом чате. Для чатов из changedChats, где ролей больше нет,
+// персональное меню удаляется.
+func (b *TelegramBot) publishUserMenus(ctx context.Context, userID int64, changedChats ...int64) error {
+	roles, err := b.userRoles(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения ролей пользователя %d: %v", userID, err)
+	}
+	var global []models.UserRole
+	chatRoles := make(map[int64][]models.UserRole)
+	for _, role := range roles {
+		if role.ChatID == 0 {
+			global = append(global, role)
+		} else {
+			chatRoles[role.ChatID] = append(chatRoles[role.ChatID], role)
+		}
+	}
+
+	private := tgbotapi.NewBotCommandScopeChat(userID)
+	if len(global) > 0 {
+		if err := b.publishMenu(private, rolesAllow(global)); err != nil {
+			return err
+		}
+	} else if err := b.deleteMenu(private); err != nil {
+		return err
+	}
+
+	for chatID, roles := range chatRoles {
+		scope := tgbotapi.NewBotCommandScopeChatMember(chatID, userID)
+		if err := b.publishMenu(scope, rolesAllow(append(roles, global...))); err != nil {
+			return err
+		}
+	}
+	for _, chatID := range changedChats {
+		if _, ok := chatRoles[chatID]; ok || chatID == 0 {
+			continue
+		}
+		if err := b.deleteMenu(tgbotapi.NewBotCommandScopeChatMember(chatID, userID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshUserMenus обновляет меню пользователя после изменения его ролей
+func (b *TelegramBot) refreshUserMenus(ctx context.Context, userID int64, chatID int64) {
+	if err := b.publishUserMenus(ctx, userID, chatID); err != nil {
+		log.Printf("Ошибка обновления меню команд пользователя %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// menuCommands возвращает команды, опубликованные для области видимости на языке lang
+func menuCommands(api *fakeAPI, scope tgbotapi.BotCommandScope, lang string) (map[string]bool, bool) {
+	var commands map[string]bool
+	found := false
+	for _, c := range api.sent {
+		switch config := c.(type) {
+		case tgbotapi.SetMyCommandsConfig:
+			if config.Scope != nil && *config.Scope == scope && config.LanguageCode == lang {
+				commands = make(map[string]bool)
+				for _, cmd := range config.Commands {
+					commands[cmd.Command] = true
+				}
+				found = true
+			}
+		case tgbotapi.DeleteMyCommandsConfig:
+			if config.Scope != nil && *config.Scope == scope && config.LanguageCode == lang {
+				commands, found = nil, false
+			}
+		}
+	}
+	return commands, found
+}
+
+func TestRegisterCommandsScopes(t *testing.T) {
+	b, api, _ := newTestBot()
+	if err := b.RegisterCommands(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults, ok := menuCommands(api, tgbotapi.NewBotCommandScopeDefault(), "")
+	if !ok || !defaults["all"] || defaults["del_user"] {
+		t.Errorf("неверное общее меню: %v", defaults)
+	}
+
+	chatAdmins, ok := menuCommands(api, tgbotapi.NewBotCommandScopeAllChatAdministrators(), "en")
+	if !ok || !chatAdmins["add_to_group"] || chatAdmins["del_user"] {
+		t.Errorf("неверное меню администраторов чатов: %v", chatAdmins)
+	}
+
+	owner, ok := menuCommands(api, tgbotapi.NewBotCommandScopeChat(testAdminID), "")
+	if !ok || !owner["grant"] || !owner["del_user"] {
+		t.Errorf("неверное меню владельца: %v", owner)
+	}
+}
+
+func TestRegisterCommandsContinuesAfterUserError(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddChat(testCtx, testTargetID, "target")
+	db.GrantRole(testCtx, testUserID, models.RoleManager, testTargetID)
+	db.GrantRole(testCtx, 300, models.RoleManager, testTargetID)
+	// Публикация меню владельца завершается ошибкой
+	api.requestErr = func(c tgbotapi.Chattable) error {
+		if config, ok := c.(tgbotapi.SetMyCommandsConfig); ok && config.Scope != nil && config.Scope.ChatID == testAdminID {
+			return errors.New("bad request")
+		}
+		return nil
+	}
+
+	err := b.RegisterCommands(testCtx)
+	if err == nil || !strings.Contains(err.Error(), "1 из 3") {
+		t.Errorf("ожидалась общая ошибка для одного пользователя из трех, получено %v", err)
+	}
+	for _, userID := range []int64{testUserID, 300} {
+		scope := tgbotapi.NewBotCommandScopeChatMember(testTargetID, userID)
+		if _, ok := menuCommands(api, scope, ""); !ok {
+			t.Errorf("меню пользователя %d не опубликовано после ошибки у другого пользователя", userID)
+		}
+	}
+}
+
+func TestRoleChangeRepublishesMenu(t *testing.T) {
+	b, api, db := newTestBot()
+	db.AddChat(testCtx, testTargetID, "target")
+	scope := tgbotapi.NewBotCommandScopeChatMember(testTargetID, testUserID)
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/grant 200 manager -300"))
+	commands, ok := menuCommands(api, scope, "")
+	if !ok || !commands["add_to_group"] {
+		t.Fatalf("меню менеджера не опубликовано: %v", commands)
+	}
+
+	b.HandleCommand(testCtx, commandUpdate(testAdminID, "/revoke 200 manager -300"))
+	if _, ok := menuCommands(api, scope, ""); ok {
+		t.Error("меню менеджера не удалено после отзыва роли")
+	}
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const muteUsage = `Использование:
+/mute_mentions - не упоминать меня в этом чате
+/mute_mentions all - не упоминать меня ни в одном чате
+/mute_mentions [all] <ЧЧ:ММ-ЧЧ:ММ> [часовой_пояс] - тихие часы, например /mute_mentions 23:00-08:00 Europe/Moscow
+/unmute_mentions [all] - снова включить упоминания`
+
+// parseMuteArgs разбирает аргументы /mute_mentions: [all] [ЧЧ:ММ-ЧЧ:ММ] [часовой_пояс]
+func parseMuteArgs(args []string) (global bool, from, to, timezone string, err error) {
+	if len(args) > 0 && strings.EqualFold(args[0], "all") {
+		global = true
+		args = args[1:]
+	}
+
+	if len(args) > 0 {
+		parts := strings.Split(args[0], "-")
+		if len(parts) != 2 {
+			return false, "", "", "", fmt.Errorf("неверный формат тихих часов %q, ожидается ЧЧ:ММ-ЧЧ:ММ", args[0])
+		}
+		from, to = parts[0], parts[1]
+		if _, err := models.ParseClock(from); err != nil {
+			return false, "", "", "", err
+		}
+		if _, err := models.ParseClock(to); err != nil {
+			return false, "", "", "", err
+		}
+		if from == to {
+			return false, "", "", "", fmt.Errorf("начало и конец тихих часов совпадают: %s", args[0])
+		}
+		args = args[1:]
+	}
+
+	if len(args) > 0 {
+		timezone = args[0]
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return false, "", "", "", fmt.Errorf("неизвестный часовой пояс: %s", timezone)
+		}
+		args = args[1:]
+	}
+
+	if len(args) > 0 {
+		return false, "", "", "", fmt.Errorf("лишние аргументы: %s", strings.Join(args, " "))
+	}
+	return global, from, to, timezone, nil
+}
+
+// muteScopeChatID возвращает ChatID для отключения упоминаний.
+// В личном чате отключение всегда глобальное.
+func muteScopeChatID(chat *tgbotapi.Chat, global bool) int64 {
+	if global || chat.IsPrivate() {
+		return models.GlobalMuteChatID
+	}
+	return chat.ID
+}
+
+// handleMuteMentions обрабатывает команду /mute_mentions
+func (b *TelegramBot) handleMuteMentions(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+
+	global, from, to, timezone, err := parseMuteArgs(strings.Fields(msg.CommandArguments()))
+	if err != nil {
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("%v\n\n%s", err, muteUsage))
+		b.bot.Send(reply)
+		return
+	}
+
+	mute := &models.MentionMute{
+		UserID:    msg.From.ID,
+		ChatID:    muteScopeChatID(msg.Chat, global),
+		QuietFrom: from,
+		QuietTo:   to,
+		Timezone:  timezone,
+	}
+	if err := b.db.MuteMentions(ctx, mute); err != nil {
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка отключения упоминаний: %v", err))
+		b.bot.Send(reply)
+		return
+	}
+
+	where := "в этом чате"
+	if mute.IsGlobal() {
+		where = "во всех чатах"
+	}
+	reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Упоминания отключены %s: %s", where, mute.Describe()))
+	b.bot.Send(reply)
+}
+
+// handleUnmuteMentions обрабатывает команду /unmute_mentions
+func (b *TelegramBot) handleUnmuteMentions(ctx context.Context, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+
+	global := false
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && strings.EqualFold(args[0], "all"):
+		global = true
+	default:
+		reply := tgbotapi.NewMessage(chatID, muteUsage)
+		b.bot.Send(reply)
+		return
+	}
+
+	scopeChatID := muteScopeChatID(msg.Chat, global)
+	if err := b.db.UnmuteMentions(ctx, msg.From.ID, scopeChatID); err != nil {
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Ошибка включения упоминаний: %v", err))
+		b.bot.Send(reply)
+		return
+	}
+
+	where := "в этом чате"
+	if scopeChatID == models.GlobalMuteChatID {
+		where = "во всех чатах"
+	}
+	reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Упоминания снова включены %s", where))
+	b.bot.Send(reply)
+}
+
+// describeMuteScope возвращает название чата, к которому относится отключение
+func (b *TelegramBot) describeMuteScope(ctx context.Context, mute models.MentionMute) string {
+	if mute.IsGlobal() {
+		return "все чаты"
+	}
+	if chat, err := b.db.GetChat(ctx, mute.ChatID); err == nil {
+		return chat.Title
+	}
+	return fmt.Sprintf("чат %d", mute.ChatID)
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMuteArgs(t *testing.T) {
+	cases := []struct {
+		args     string
+		global   bool
+		from, to string
+		timezone string
+		wantErr  string
+	}{
+		{args: ""},
+		{args: "all", global: true},
+		{args: "ALL", global: true},
+		{args: "23:00-08:00", from: "23:00", to: "08:00"},
+		{args: "all 09:00-18:00 Europe/Moscow", global: true, from: "09:00", to: "18:00", timezone: "Europe/Moscow"},
+		{args: "23:00", wantErr: "неверный формат тихих часов"},
+		{args: "23:00-08:00-09:00", wantErr: "неверный формат тихих часов"},
+		{args: "25:00-08:00", wantErr: "неверный формат времени"},
+		{args: "23:00-8", wantErr: "неверный формат времени"},
+		{args: "10:00-10:00", wantErr: "совпадают"},
+		{args: "23:00-08:00 Mars/Base", wantErr: "неизвестный часовой пояс"},
+		{args: "23:00-08:00 Europe/Moscow extra", wantErr: "лишние аргументы: extra"},
+		{args: "all 23:00-08:00 UTC one two", wantErr: "лишние аргументы: one two"},
+	}
+
+	for _, tc := range cases {
+		global, from, to, timezone, err := parseMuteArgs(strings.Fields(tc.args))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%q: ошибка %v, ожидалась %q", tc.args, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: неожиданная ошибка: %v", tc.args, err)
+			continue
+		}
+		if global != tc.global || from != tc.from || to != tc.to || timezone != tc.timezone {
+			t.Errorf("%q: разобрано (%v, %q, %q, %q)", tc.args, global, from, to, timezone)
+		}
+	}
+}
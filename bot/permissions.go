@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"weveryone_bot_v2/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Permission - именованное право на выполнение действий в боте
+type Permission string
+
+const (
+	// PermAdminPanel - доступ к админ-панели и просмотру данных
+	PermAdminPanel Permission = "admin_panel"
+	// PermManageUsers - создание, изменение и удаление пользователей
+	PermManageUsers Permission = "manage_users"
+	// PermManageChats - создание, изменение и удаление чатов
+	PermManageChats Permission = "manage_chats"
+	// PermManageGroups - создание и удаление групп, привязка групп к чатам
+	PermManageGroups Permission = "manage_groups"
+	// PermManageMembers - управление участниками чатов и групп
+	PermManageMembers Permission = "manage_members"
+	// PermManageRoles - выдача и отзыв ролей
+	PermManageRoles Permission = "manage_roles"
+	// PermBypassCooldown - использование команд без ограничения частоты
+	PermBypassCooldown Permission = "bypass_cooldown"
+)
+
+// rolePermissions описывает права каждой роли
+var rolePermissions = map[string][]Permission{
+	models.RoleOwner: {
+		PermAdminPanel, PermManageUsers, PermManageChats, PermManageGroups,
+		PermManageMembers, PermManageRoles, PermBypassCooldown,
+	},
+	models.RoleAdmin: {
+		PermAdminPanel, PermManageUsers, PermManageChats, PermManageGroups,
+		PermManageMembers, PermManageRoles, PermBypassCooldown,
+	},
+	models.RoleModerator: {
+		PermAdminPanel, PermManageGroups, PermManageMembers, PermBypassCooldown,
+	},
+	models.RoleManager: {
+		PermAdminPanel, PermManageGroups, PermManageMembers, PermBypassCooldown,
+	},
+}
+
+// roleNames - описания ролей для пользователей
+var roleNames = map[string]string{
+	models.RoleOwner:     "владелец",
+	models.RoleAdmin:     "администратор",
+	models.RoleModerator: "модератор",
+	models.RoleManager:   "менеджер чата",
+}
+
+// roleHasPermission проверяет, входит ли право в роль
+func roleHasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// userRoles возвращает роли пользователя, включая владельца из ADMIN_ID.
+// Роль владельца из ADMIN_ID возвращается и при ошибке чтения ролей из базы.
+func (b *TelegramBot) userRoles(ctx context.Context, userID int64) ([]models.UserRole, error) {
+	roles, err := b.db.GetUserRoles(ctx, userID)
+	if userID == b.adminID {
+		roles = append(roles, models.UserRole{UserID: userID, Role: models.RoleOwner})
+	}
+	return roles, err
+}
+
+// HasPermission проверяет, есть ли у пользователя право в чате.
+// Глобальные роли действуют во всех чатах, роль менеджера - только в своем чате.
+// Администраторы группового чата в Telegram получают права менеджера этого чата.
+// При chatID = 0 учитываются только глобальные роли.
+func (b *TelegramBot) HasPermission(ctx context.Context, userID int64, chatID int64, perm Permission) bool {
+	roles, err := b.userRoles(ctx, userID)
+	if err != nil {
+		log.Printf("Ошибка получения ролей пользователя %d: %v", userID, err)
+	}
+	for _, role := range roles {
+		if role.ChatID != 0 && role.ChatID != chatID {
+			continue
+		}
+		if roleHasPermission(role.Role, perm) {
+			return true
+		}
+	}
+
+	if chatID != 0 && roleHasPermission(models.RoleManager, perm) {
+		return b.isChatAdministrator(chatID, userID)
+	}
+	return false
+}
+
+// groupScope возвращает чат для проверки прав на управление группой.
+// Менеджеры чата управляют только группами, привязанными к одному их чату:
+// общими для нескольких чатов группами управляют глобальные роли.
+func (b *TelegramBot) groupScope(ctx context.Context, groupName string, chatID int64) int64 {
+	chats, err := b.db.GetChatsForGroup(ctx, groupName)
+	if err != nil {
+		log.Printf("Ошибка получения чатов группы %s: %v", groupName, err)
+		return 0
+	}
+	if len(chats) == 1 && chats[0].ChatID == chatID {
+		return chatID
+	}
+	return 0
+}
+
+// requirePermission проверяет право пользователя в чате scopeChatID
+// и сообщает об отказе в доступе в чат replyChatID
+func (b *TelegramBot) requirePermission(ctx context.Context, userID int64, scopeChatID int64, perm Permission, replyChatID int64) bool {
+	if b.HasPermission(ctx, userID, scopeChatID, perm) {
+		return true
+	}
+	msg := tgbotapi.NewMessage(replyChatID, "У вас нет доступа к этой функции.")
+	b.bot.Send(msg)
+	return false
+}
+
+// canGrantRole проверяет, может ли пользователь выдавать и отзывать роль.
+// Роли владельца и администратора может выдавать только владелец.
+func (b *TelegramBot) canGrantRole(ctx context.Context, userID int64, role string, chatID int64) bool {
+	if !b.HasPermission(ctx, userID, chatID, PermManageRoles) {
+		return false
+	}
+	if role == models.RoleOwner || role == models.RoleAdmin {
+		roles, err := b.userRoles(ctx, userID)
+		if err != nil {
+			log.Printf("Ошибка получения ролей пользователя %d: %v", userID, err)
+		}
+		for _, r := range roles {
+			if r.Role == models.RoleOwner {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// validateRoleArgs проверяет роль и чат из аргументов /grant и /revoke
+func validateRoleArgs(role string, chatID int64) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("неизвестная роль %s", role)
+	}
+	if role == models.RoleManager && chatID == 0 {
+		return fmt.Errorf("для роли manager нужно указать chat_id")
+	}
+	if role != models.RoleManager && chatID != 0 {
+		return fmt.Errorf("роль %s выдается глобально, chat_id не нужен", role)
+	}
+	return nil
+}
+
+const roleUsage = "Роли: owner, admin, moderator, manager (для чата)"
+
+// handleGrant обрабатывает команду /grant <user_id> <role> [chat_id]
+func (b *TelegramBot) handleGrant(c *commandContext) {
+	targetUserID, role, targetChatID := c.ID("user_id"), strings.ToLower(c.String("role")), c.ID("chat_id")
+	if err := validateRoleArgs(role, targetChatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("%v\n\n%s", err, roleUsage))
+		return
+	}
+	if !b.canGrantRole(c.ctx, c.userID, role, targetChatID) {
+		b.sendText(c.chatID, "У вас нет доступа к этой функции.")
+		return
+	}
+	if err := b.db.GrantRole(c.ctx, targetUserID, role, targetChatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка выдачи роли: %v", err))
+		return
+	}
+	b.refreshUserMenus(c.ctx, targetUserID, targetChatID)
+	b.sendText(c.chatID, fmt.Sprintf("Пользователю %d выдана роль %s", targetUserID, describeRole(models.UserRole{Role: role, ChatID: targetChatID})))
+}
+
+// handleRevoke обрабатывает команду /revoke <user_id> <role> [chat_id]
+func (b *TelegramBot) handleRevoke(c *commandContext) {
+	targetUserID, role, targetChatID := c.ID("user_id"), strings.ToLower(c.String("role")), c.ID("chat_id")
+	if err := validateRoleArgs(role, targetChatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("%v\n\n%s", err, roleUsage))
+		return
+	}
+	if !b.canGrantRole(c.ctx, c.userID, role, targetChatID) {
+		b.sendText(c.chatID, "У вас нет доступа к этой функции.")
+		return
+	}
+	if targetUserID == b.adminID && role == models.RoleOwner {
+		b.sendText(c.chatID, "Нельзя отозвать роль владельца, заданного в ADMIN_ID")
+		return
+	}
+	if err := b.db.RevokeRole(c.ctx, targetUserID, role, targetChatID); err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка отзыва роли: %v", err))
+		return
+	}
+	b.refreshUserMenus(c.ctx, targetUserID, targetChatID)
+	b.sendText(c.chatID, fmt.Sprintf("У пользователя %d отозвана роль %s", targetUserID, describeRole(models.UserRole{Role: role, ChatID: targetChatID})))
+}
+
+// handleRoles обрабатывает команду /roles
+func (b *TelegramBot) handleRoles(c *commandContext) {
+	roles, err := b.db.ListRoles(c.ctx)
+	if err != nil {
+		b.sendText(c.chatID, fmt.Sprintf("Ошибка получения ролей: %v", err))
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("Роли пользователей:\n\n")
+	text.WriteString(fmt.Sprintf("- %d: %s (ADMIN_ID)\n", b.adminID, roleNames[models.RoleOwner]))
+	for _, role := range roles {
+		text.WriteString(fmt.Sprintf("- %d: %s\n", role.UserID, describeRole(role)))
+	}
+	b.sendText(c.chatID, text.String())
+}
+
+// describeRole возвращает описание роли с учетом чата
+func describeRole(role models.UserRole) string {
+	name := roleNames[role.Role]
+	if name == "" {
+		name = role.Role
+	}
+	if role.ChatID != 0 {
+		return fmt.Sprintf("%s (чат %d)", name, role.ChatID)
+	}
+	return name
+}
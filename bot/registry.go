@@ -0,0 +1,349 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandSection - раздел справки, в котором показывается команда
+type commandSection int
+
+const (
+	sectionMain commandSection = iota
+	sectionAdmin
+)
+
+var sectionTitles = map[commandSection]string{
+	sectionMain:  "Основные команды",
+	sectionAdmin: "Команды администратора",
+}
+
+// argType - тип аргумента команды
+type argType int
+
+const (
+	// argText - произвольное слово
+	argText argType = iota
+	// argID - целочисленный идентификатор пользователя или чата
+	argID
+)
+
+// argSpec описывает аргумент команды
+type argSpec struct {
+	Name     string
+	Type     argType
+	Optional bool
+	// Variadic - аргумент забирает все оставшиеся слова
+	// (для текста они склеиваются через пробел, для ID разбираются по отдельности)
+	Variadic bool
+}
+
+// command описывает команду бота: имя, аргументы, право доступа и обработчик
+type command struct {
+	Name        string
+	Aliases     []string
+	Args        []argSpec
+	Description string
+	// Translations - описания команды на других языках для меню Telegram (ключ - код языка)
+	Translations map[string]string
+	Section      commandSection
+
+	// Permission - право, необходимое для выполнения команды (пустое - команда доступна всем)
+	Permission Permission
+	// Scope возвращает чат, в рамках которого проверяется право.
+	// Если не задан, право проверяется глобально до разбора аргументов.
+	Scope func(c *commandContext) int64
+
+	// CustomArgs - обработчик разбирает аргументы сам, Args используются только в справке
+	CustomArgs bool
+	// Suggest возвращает варианты вызова команды, которые показываются вместе с подсказкой об использовании
+	Suggest func(c *commandContext) []string
+
+	Handler func(c *commandContext)
+}
+
+// maxSuggestions ограничивает количество подсказок в одном сообщении
+const maxSuggestions = 20
+
+// usage возвращает строку использования команды, например "/add_to_chat <user_id> <chat_id>"
+func (cmd *command) usage() string {
+	var usage strings.Builder
+	usage.WriteString("/" + cmd.Name)
+	for _, arg := range cmd.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Optional {
+			usage.WriteString(fmt.Sprintf(" [%s]", name))
+		} else {
+			usage.WriteString(fmt.Sprintf(" <%s>", name))
+		}
+	}
+	return usage.String()
+}
+
+// commandContext содержит сообщение с командой, разобранные аргументы
+// и контекст, ограничивающий время обработки обновления
+type commandContext struct {
+	ctx    context.Context
+	msg    *tgbotapi.Message
+	chatID int64
+	userID int64
+	args   map[string][]string
+}
+
+// Has проверяет, передан ли аргумент
+func (c *commandContext) Has(name string) bool {
+	return len(c.args[name]) > 0
+}
+
+// String возвращает текстовый аргумент
+func (c *commandContext) String(name string) string {
+	return strings.Join(c.args[name], " ")
+}
+
+// ID возвращает аргумент-идентификатор. Формат проверяется при разборе аргументов.
+func (c *commandContext) ID(name string) int64 {
+	if !c.Has(name) {
+		return 0
+	}
+	id, _ := strconv.ParseInt(c.args[name][0], 10, 64)
+	return id
+}
+
+// IDs возвращает список идентификаторов из variadic-аргумента
+func (c *commandContext) IDs(name string) []int64 {
+	ids := make([]int64, 0, len(c.args[name]))
+	for _, value := range c.args[name] {
+		id, _ := strconv.ParseInt(value, 10, 64)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// errUsage означает, что количество аргументов не соответствует описанию команды
+var errUsage = fmt.Errorf("неверное количество аргументов")
+
+// parseArgs разбирает слова после команды в соответствии с описанием аргументов
+func (cmd *command) parseArgs(words []string) (map[string][]string, error) {
+	args := make(map[string][]string)
+	for _, spec := range cmd.Args {
+		if len(words) == 0 {
+			if !spec.Optional {
+				return nil, errUsage
+			}
+			continue
+		}
+
+		values := words[:1]
+		if spec.Variadic {
+			values = words
+		}
+		if spec.Type == argID {
+			for _, value := range values {
+				if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+					return nil, fmt.Errorf("Неверный формат %s", spec.Name)
+				}
+			}
+		}
+		args[spec.Name] = values
+		words = words[len(values):]
+	}
+
+	if len(words) > 0 {
+		return nil, errUsage
+	}
+	return args, nil
+}
+
+// commandRegistry хранит команды бота и ищет их по имени или псевдониму
+type commandRegistry struct {
+	commands []*command
+	byName   map[string]*command
+}
+
+func newCommandRegistry(commands []*command) *commandRegistry {
+	r := &commandRegistry{
+		commands: commands,
+		byName:   make(map[string]*command),
+	}
+	for _, cmd := range commands {
+		r.byName[cmd.Name] = cmd
+		for _, alias := range cmd.Aliases {
+			r.byName[alias] = cmd
+		}
+	}
+	return r
+}
+
+// lookup ищет команду по имени или псевдониму
+func (r *commandRegistry) lookup(name string) (*command, bool) {
+	cmd, ok := r.byName[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// suggest возвращает команды, имя или псевдоним которых начинается с prefix
+func (r *commandRegistry) suggest(prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	var suggestions []string
+	for _, cmd := range r.commands {
+		names := append([]string{cmd.Name}, cmd.Aliases...)
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				suggestions = append(suggestions, fmt.Sprintf("/%s - %s", name, cmd.Description))
+				break
+			}
+		}
+	}
+	return suggestions
+}
+
+// helpText формирует справку по командам
+func (r *commandRegistry) helpText() string {
+	var text strings.Builder
+	text.WriteString("Доступные команды:\n")
+
+	sections := []commandSection{sectionMain, sectionAdmin}
+	for _, section := range sections {
+		text.WriteString(fmt.Sprintf("\n%s:\n", sectionTitles[section]))
+		for _, cmd := range r.commands {
+			if cmd.Section != section {
+				continue
+			}
+			line := cmd.usage()
+			for _, alias := range cmd.Aliases {
+				line += " или /" + alias
+			}
+			text.WriteString(fmt.Sprintf("%s - %s\n", line, cmd.Description))
+		}
+	}
+	return strings.TrimSuffix(text.String(), "\n")
+}
+
+// description возвращает описание команды на языке lang, по умолчанию - на русском
+func (cmd *command) description(lang string) string {
+	if text, ok := cmd.Translations[lang]; ok {
+		return text
+	}
+	return cmd.Description
+}
+
+// menuPermission возвращает право, без которого команда не показывается в меню
+func (cmd *command) menuPermission() Permission {
+	if cmd.Permission == "" && cmd.Section == sectionAdmin {
+		return PermAdminPanel
+	}
+	return cmd.Permission
+}
+
+// languages возвращает языки, на которые переведены описания команд
+func (r *commandRegistry) languages() []string {
+	seen := make(map[string]bool)
+	var languages []string
+	for _, cmd := range r.commands {
+		for lang := range cmd.Translations {
+			if !seen[lang] {
+				seen[lang] = true
+				languages = append(languages, lang)
+			}
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// botCommands возвращает команды для setMyCommands на языке lang.
+// Команды с правами включаются, только если allowed разрешает нужное право.
+func (r *commandRegistry) botCommands(lang string, allowed func(Permission) bool) []tgbotapi.BotCommand {
+	var result []tgbotapi.BotCommand
+	for _, cmd := range r.commands {
+		if perm := cmd.menuPermission(); perm != "" && (allowed == nil || !allowed(perm)) {
+			continue
+		}
+		names := append([]string{cmd.Name}, cmd.Aliases...)
+		for _, name := range names {
+			result = append(result, tgbotapi.BotCommand{
+				Command:     name,
+				Description: cmd.description(lang),
+			})
+		}
+	}
+	return result
+}
+
+// HandleCommand находит команду в реестре, проверяет права и аргументы и вызывает обработчик
+func (b *TelegramBot) HandleCommand(ctx context.Context, update tgbotapi.Update) {
+	msg := update.Message
+	chatID := msg.Chat.ID
+
+	cmd, ok := b.commands.lookup(msg.Command())
+	if !ok {
+		if suggestions := b.commands.suggest(msg.Command()); len(suggestions) > 0 {
+			reply := tgbotapi.NewMessage(chatID, "Возможно, вы имели в виду:\n\n"+strings.Join(suggestions, "\n"))
+			b.bot.Send(reply)
+			return
+		}
+		reply := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /help для просмотра доступных команд.")
+		b.bot.Send(reply)
+		return
+	}
+
+	c := &commandContext{
+		ctx:    ctx,
+		msg:    msg,
+		chatID: chatID,
+		userID: msg.From.ID,
+	}
+
+	// Права без привязки к аргументам проверяем до разбора, чтобы не раскрывать подсказки
+	if cmd.Permission != "" && cmd.Scope == nil {
+		if !b.requirePermission(ctx, c.userID, 0, cmd.Permission, chatID) {
+			return
+		}
+	}
+
+	if !cmd.CustomArgs {
+		args, err := cmd.parseArgs(strings.Fields(msg.CommandArguments()))
+		if err != nil {
+			b.sendUsage(c, cmd, err)
+			return
+		}
+		c.args = args
+	}
+
+	if cmd.Permission != "" && cmd.Scope != nil {
+		if !b.requirePermission(ctx, c.userID, cmd.Scope(c), cmd.Permission, chatID) {
+			return
+		}
+	}
+
+	cmd.Handler(c)
+}
+
+// sendUsage сообщает об ошибке в аргументах команды и показывает подсказки
+func (b *TelegramBot) sendUsage(c *commandContext, cmd *command, err error) {
+	text := "Использование: " + cmd.usage()
+	if err != errUsage {
+		text = err.Error()
+	}
+
+	if err == errUsage && cmd.Suggest != nil {
+		suggestions := cmd.Suggest(c)
+		sort.Strings(suggestions)
+		if len(suggestions) > maxSuggestions {
+			suggestions = suggestions[:maxSuggestions]
+		}
+		if len(suggestions) > 0 {
+			text += "\n\nВозможные варианты:\n" + strings.Join(suggestions, "\n")
+		}
+	}
+
+	reply := tgbotapi.NewMessage(c.chatID, text)
+	b.bot.Send(reply)
+}
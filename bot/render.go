@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// render показывает экран админ-панели. Если экран открыт нажатием кнопки, сообщение с кнопкой
+// редактируется на месте; новое сообщение отправляется, только когда редактировать нечего
+// или Telegram не позволяет изменить сообщение (например, слишком старое).
+func (b *TelegramBot) render(msg tgbotapi.MessageConfig, update *tgbotapi.Update) {
+	if update != nil && update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+		source := update.CallbackQuery.Message
+		edit := tgbotapi.NewEditMessageText(source.Chat.ID, source.MessageID, msg.Text)
+		edit.Entities = msg.Entities
+		if markup, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+			edit.ReplyMarkup = &markup
+		}
+
+		_, err := b.bot.Request(edit)
+		if err == nil || isNotModified(err) {
+			return
+		}
+		log.Printf("Не удалось отредактировать сообщение %d в чате %d: %v", source.MessageID, source.Chat.ID, err)
+	}
+	b.bot.Send(msg)
+}
+
+// renderLoadError показывает вместо экрана сообщение об ошибке чтения из базы данных,
+// чтобы сбой не выглядел как пустой список
+func (b *TelegramBot) renderLoadError(chatID int64, what string, err error, back callback, update *tgbotapi.Update) {
+	log.Printf("Не удалось загрузить %s: %v", what, err)
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Не удалось загрузить %s: ошибка базы данных. Попробуйте позже.", what))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			b.button("Назад", back),
+		),
+	)
+	b.render(msg, update)
+}
+
+// isNotModified проверяет, что Telegram отклонил редактирование, потому что сообщение не изменилось
+func isNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+// callbackNotice - уведомление, которое показывается в ответ на нажатие кнопки
+type callbackNotice struct {
+	text  string
+	alert bool
+}
+
+// toast создает всплывающее уведомление, которое исчезает само
+func toast(text string) callbackNotice {
+	return callbackNotice{text: text}
+}
+
+// alert создает уведомление, которое нужно закрыть вручную
+func alert(text string) callbackNotice {
+	return callbackNotice{text: text, alert: true}
+}
+
+// answerCallback отвечает на callback-запрос, чтобы клиент перестал показывать индикатор загрузки
+func (b *TelegramBot) answerCallback(queryID string, notice callbackNotice) {
+	config := tgbotapi.NewCallback(queryID, notice.text)
+	config.ShowAlert = notice.alert
+	if _, err := b.bot.Request(config); err != nil {
+		log.Printf("Ошибка ответа на callback: %v", err)
+	}
+}
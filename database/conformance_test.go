@@ -0,0 +1,756 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+	"weveryone_bot_v2/interfaces"
+	"weveryone_bot_v2/models"
+)
+
+// conformanceTests - проверки, которые должна проходить любая реализация interfaces.Database.
+// Каждая проверка получает чистую базу.
+var conformanceTests = []struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, db interfaces.Database)
+}{
+	{"Users", testUsers},
+	{"UpsertUser", testUpsertUser},
+	{"SetUsername", testSetUsername},
+	{"Chats", testChats},
+	{"Groups", testGroups},
+	{"RenameGroupOntoDeleted", testRenameGroupOntoDeleted},
+	{"Relations", testRelations},
+	{"Mentions", testMentions},
+	{"DeleteAndRestore", testDeleteAndRestore},
+	{"GroupMembers", testGroupMembers},
+	{"DeleteChatAndGroup", testDeleteChatAndGroup},
+	{"Purge", testPurge},
+	{"MentionMutes", testMentionMutes},
+	{"Roles", testRoles},
+	{"CommandUsage", testCommandUsage},
+	{"Conversations", testConversations},
+}
+
+// runConformance запускает проверки на базах, которые создает open
+func runConformance(t *testing.T, open func(t *testing.T) interfaces.Database) {
+	for _, tc := range conformanceTests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, context.Background(), open(t))
+		})
+	}
+}
+
+// groupNames возвращает отсортированные названия групп
+func groupNames(groups []models.Group) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func testUsers(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddUser(ctx, 1, "alice", "Alice", "Smith"))
+	must(t, db.AddUser(ctx, 2, "", "Bob", ""))
+
+	// Повторное добавление не меняет пользователя и не считается ошибкой
+	if err := db.AddUser(ctx, 1, "other", "", ""); err != nil {
+		t.Errorf("повторное добавление пользователя вернуло ошибку: %v", err)
+	}
+
+	user, err := db.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.Username != "alice" || user.FirstName != "Alice" || user.LastName != "Smith" {
+		t.Errorf("неожиданный пользователь: %+v", user)
+	}
+
+	if !has(db.UserExists(ctx, 2)) || has(db.UserExists(ctx, 3)) {
+		t.Error("UserExists возвращает неверный результат")
+	}
+	if _, err := db.GetUser(ctx, 3); err == nil {
+		t.Error("GetUser не вернул ошибку для несуществующего пользователя")
+	}
+
+	users, err := db.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{1, 2}) {
+		t.Errorf("ListUsers вернул %v", ids)
+	}
+}
+
+func testUpsertUser(t *testing.T, ctx context.Context, db interfaces.Database) {
+	must(t, db.UpsertUser(ctx, &models.User{UserID: 1, Username: "old", FirstName: "Alice"}))
+	must(t, db.UpsertUser(ctx, &models.User{UserID: 1, Username: "new", FirstName: "Alice", LanguageCode: "ru"}))
+
+	user, err := db.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.Username != "new" || user.LanguageCode != "ru" {
+		t.Errorf("пользователь не обновлен: %+v", user)
+	}
+
+	history, err := db.GetUsernameHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUsernameHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Username != "old" {
+		t.Errorf("неожиданная история username: %+v", history)
+	}
+}
+
+func testSetUsername(t *testing.T, ctx context.Context, db interfaces.Database) {
+	must(t, db.UpsertUser(ctx, &models.User{UserID: 1, Username: "telegram", FirstName: "Alice"}))
+	must(t, db.SetUsername(ctx, 1, "admin_set"))
+
+	// Синхронизация с Telegram обновляет имя, но не username, заданный администратором
+	must(t, db.UpsertUser(ctx, &models.User{UserID: 1, Username: "telegram", FirstName: "Alicia"}))
+	user, err := db.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.Username != "admin_set" || user.FirstName != "Alicia" || !user.UsernameLocked {
+		t.Errorf("username администратора перезаписан: %+v", user)
+	}
+
+	history, err := db.GetUsernameHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUsernameHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Username != "telegram" {
+		t.Errorf("неожиданная история username: %+v", history)
+	}
+
+	if err := db.SetUsername(ctx, 2, "nobody"); err == nil {
+		t.Error("SetUsername для несуществующего пользователя не вернул ошибку")
+	}
+}
+
+func testChats(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddChat(ctx, -100, "team"))
+	if err := db.AddChat(ctx, -100, "other"); err != nil {
+		t.Errorf("повторное добавление чата вернуло ошибку: %v", err)
+	}
+
+	chat, err := db.GetChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetChat: %v", err)
+	}
+	if chat.Title != "team" || !chat.Active {
+		t.Errorf("неожиданный чат: %+v", chat)
+	}
+
+	must(t, db.SetChatTitle(ctx, -100, "renamed"))
+	must(t, db.SetChatActive(ctx, -100, false))
+	chat, err = db.GetChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetChat: %v", err)
+	}
+	if chat.Title != "renamed" || chat.Active {
+		t.Errorf("чат не обновлен: %+v", chat)
+	}
+
+	if err := db.SetChatTitle(ctx, -200, "missing"); err == nil {
+		t.Error("SetChatTitle не вернул ошибку для несуществующего чата")
+	}
+	if has(db.ChatExists(ctx, -200)) {
+		t.Error("ChatExists вернул true для несуществующего чата")
+	}
+}
+
+func testGroups(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddGroup(ctx, "dev"))
+	must(t, db.AddGroup(ctx, "ops"))
+	must(t, db.AddUserToGroup(ctx, 1, "dev"))
+	must(t, db.LinkGroupToChat(ctx, "dev", -100))
+
+	if err := db.RenameGroup(ctx, "dev", "ops"); err == nil {
+		t.Error("RenameGroup разрешил занятое название")
+	}
+	must(t, db.RenameGroup(ctx, "dev", "backend"))
+
+	if has(db.GroupExists(ctx, "dev")) || !has(db.GroupExists(ctx, "backend")) {
+		t.Error("группа не переименована")
+	}
+	users, err := db.GetUsersForGroup(ctx, "backend")
+	if err != nil {
+		t.Fatalf("GetUsersForGroup: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{1}) {
+		t.Errorf("участники переименованной группы: %v", ids)
+	}
+	if !has(db.GroupLinkedToChat(ctx, "backend", -100)) {
+		t.Error("переименованная группа отвязалась от чата")
+	}
+
+	groups, err := db.ListGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if names := groupNames(groups); len(names) != 2 || names[0] != "backend" || names[1] != "ops" {
+		t.Errorf("ListGroups вернул %v", names)
+	}
+}
+
+func testRenameGroupOntoDeleted(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddGroup(ctx, "dev"))
+	must(t, db.AddGroup(ctx, "ops"))
+	must(t, db.DeleteGroup(ctx, "ops"))
+
+	// Название удаленной группы занято, пока ее можно восстановить
+	if err := db.RenameGroup(ctx, "dev", "ops"); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("RenameGroup в название удаленной группы вернул %v, ожидалась ErrDeleted", err)
+	}
+	if !has(db.GroupExists(ctx, "dev")) {
+		t.Error("группа переименована, несмотря на ошибку")
+	}
+	must(t, db.RestoreGroup(ctx, "ops"))
+	if !has(db.GroupExists(ctx, "ops")) {
+		t.Error("удаленная группа не восстановлена")
+	}
+}
+
+func testRelations(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddUser(ctx, 2, "bob", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddGroup(ctx, "dev"))
+
+	must(t, db.AddUserToChat(ctx, 1, -100))
+	if err := db.AddUserToChat(ctx, 1, -100); err == nil {
+		t.Error("повторное добавление в чат не вернуло ошибку")
+	}
+	if err := db.AddUserToChat(ctx, 3, -100); err == nil {
+		t.Error("добавление несуществующего пользователя в чат не вернуло ошибку")
+	}
+	if err := db.AddUserToGroup(ctx, 1, "missing"); err == nil {
+		t.Error("добавление в несуществующую группу не вернуло ошибку")
+	}
+
+	result, err := db.AddUsersToChat(ctx, []int64{1, 2, 3, 2}, -100)
+	if err != nil {
+		t.Fatalf("AddUsersToChat: %v", err)
+	}
+	if !equalIDs(result.Added, []int64{2}) || !equalIDs(result.Existing, []int64{1}) || !equalIDs(result.Unknown, []int64{3}) {
+		t.Errorf("неожиданный результат AddUsersToChat: %+v", result)
+	}
+
+	users, err := db.GetUsersForChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetUsersForChat: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{1, 2}) {
+		t.Errorf("участники чата: %v", ids)
+	}
+
+	must(t, db.AddUserToGroup(ctx, 2, "dev"))
+	must(t, db.LinkGroupToChat(ctx, "dev", -100))
+	chats, err := db.GetChatsForUser(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetChatsForUser: %v", err)
+	}
+	if ids := chatIDs(chats); !equalIDs(ids, []int64{-100}) {
+		t.Errorf("чаты пользователя: %v", ids)
+	}
+	groups, err := db.GetGroupsForChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetGroupsForChat: %v", err)
+	}
+	if names := groupNames(groups); len(names) != 1 || names[0] != "dev" {
+		t.Errorf("группы чата: %v", names)
+	}
+
+	must(t, db.RemoveUsersFromChat(ctx, []int64{1, 2}, -100))
+	must(t, db.UnlinkGroupFromChat(ctx, "dev", -100))
+	users, err = db.GetUsersForChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetUsersForChat: %v", err)
+	}
+	if len(users) != 0 || has(db.GroupLinkedToChat(ctx, "dev", -100)) {
+		t.Errorf("связи не удалены: участники %v", userIDs(users))
+	}
+}
+
+func testMentions(t *testing.T, ctx context.Context, db interfaces.Database) {
+	for _, id := range []int64{1, 2, 3} {
+		must(t, db.AddUser(ctx, id, "", "", ""))
+	}
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddChat(ctx, -200, "other"))
+	must(t, db.AddGroup(ctx, "dev"))
+	for _, id := range []int64{1, 2, 3} {
+		must(t, db.AddUserToChat(ctx, id, -100))
+	}
+	must(t, db.AddUserToGroup(ctx, 1, "dev"))
+	must(t, db.AddUserToGroup(ctx, 2, "dev"))
+
+	// Группа, не привязанная к чату, никого не упоминает
+	users, err := db.GetUsersForMention(ctx, -100, "dev")
+	if err != nil {
+		t.Fatalf("GetUsersForMention: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("упомянуты участники непривязанной группы: %v", userIDs(users))
+	}
+
+	must(t, db.LinkGroupToChat(ctx, "dev", -100))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 2, ChatID: -100}))
+
+	users, err = db.GetUsersForMention(ctx, -100, "")
+	if err != nil {
+		t.Fatalf("GetUsersForMention: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{1, 3}) {
+		t.Errorf("упоминание всех: %v", ids)
+	}
+	users, err = db.GetUsersForMention(ctx, -100, "dev")
+	if err != nil {
+		t.Fatalf("GetUsersForMention: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{1}) {
+		t.Errorf("упоминание группы: %v", ids)
+	}
+	users, err = db.GetUsersForMention(ctx, -200, "")
+	if err != nil {
+		t.Fatalf("GetUsersForMention: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("упомянуты пользователи другого чата: %v", userIDs(users))
+	}
+}
+
+func testDeleteAndRestore(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddGroup(ctx, "dev"))
+	must(t, db.AddUserToChat(ctx, 1, -100))
+	must(t, db.AddUserToGroup(ctx, 1, "dev"))
+
+	must(t, db.DeleteUser(ctx, 1))
+	if has(db.UserExists(ctx, 1)) {
+		t.Error("удаленный пользователь существует")
+	}
+	if err := db.AddUser(ctx, 1, "alice", "", ""); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("добавление удаленного пользователя вернуло %v", err)
+	}
+	if err := db.AddUserToChat(ctx, 1, -100); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("добавление удаленного пользователя в чат вернуло %v", err)
+	}
+	deleted, err := db.ListDeletedUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListDeletedUsers: %v", err)
+	}
+	if ids := userIDs(deleted); !equalIDs(ids, []int64{1}) {
+		t.Errorf("удаленные пользователи: %v", ids)
+	}
+
+	// Восстановленный пользователь возвращается без связей
+	must(t, db.RestoreUser(ctx, 1))
+	if !has(db.UserExists(ctx, 1)) {
+		t.Fatal("пользователь не восстановлен")
+	}
+	chats, err := db.GetChatsForUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetChatsForUser: %v", err)
+	}
+	groups, err := db.GetGroupsForUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetGroupsForUser: %v", err)
+	}
+	if len(chats) != 0 || len(groups) != 0 {
+		t.Errorf("связи восстановлены вместе с пользователем: чаты %v, группы %v", chatIDs(chats), groupNames(groups))
+	}
+
+	must(t, db.PurgeUser(ctx, 1))
+	if err := db.RestoreUser(ctx, 1); err == nil {
+		t.Error("восстановлен окончательно удаленный пользователь")
+	}
+	if err := db.AddUser(ctx, 1, "alice", "", ""); err != nil {
+		t.Errorf("пользователь не добавляется после окончательного удаления: %v", err)
+	}
+}
+
+func testGroupMembers(t *testing.T, ctx context.Context, db interfaces.Database) {
+	for _, id := range []int64{1, 2, 3} {
+		must(t, db.AddUser(ctx, id, "", "", ""))
+	}
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddGroup(ctx, "dev"))
+	must(t, db.DeleteUser(ctx, 3))
+
+	must(t, db.AddUserToGroup(ctx, 1, "dev"))
+	if err := db.AddUserToGroup(ctx, 1, "dev"); err != nil {
+		t.Errorf("повторное добавление в группу вернуло ошибку: %v", err)
+	}
+	result, err := db.AddUsersToGroup(ctx, []int64{1, 2, 2, 3, 4}, "dev")
+	if err != nil {
+		t.Fatalf("AddUsersToGroup: %v", err)
+	}
+	if !equalIDs(result.Added, []int64{2}) || !equalIDs(result.Existing, []int64{1}) || !equalIDs(result.Unknown, []int64{3, 4}) {
+		t.Errorf("неожиданный результат AddUsersToGroup: %+v", result)
+	}
+	if _, err := db.AddUsersToGroup(ctx, []int64{1}, "missing"); err == nil {
+		t.Error("AddUsersToGroup не вернул ошибку для несуществующей группы")
+	}
+	if _, err := db.AddUsersToChat(ctx, []int64{1}, -200); err == nil {
+		t.Error("AddUsersToChat не вернул ошибку для несуществующего чата")
+	}
+
+	must(t, db.LinkGroupToChat(ctx, "dev", -100))
+	if err := db.LinkGroupToChat(ctx, "dev", -100); err != nil {
+		t.Errorf("повторная привязка группы вернула ошибку: %v", err)
+	}
+	if err := db.LinkGroupToChat(ctx, "dev", -200); err == nil {
+		t.Error("привязка к несуществующему чату не вернула ошибку")
+	}
+
+	group, err := db.GetGroup(ctx, "dev")
+	if err != nil {
+		t.Fatalf("GetGroup: %v", err)
+	}
+	if group.Name != "dev" {
+		t.Errorf("неожиданная группа: %+v", group)
+	}
+	if _, err := db.GetGroup(ctx, "missing"); err == nil {
+		t.Error("GetGroup не вернул ошибку для несуществующей группы")
+	}
+	byID, found, err := db.GetGroupByID(ctx, group.ID)
+	if err != nil || !found || byID.Name != "dev" {
+		t.Errorf("GetGroupByID(%d) = %+v, %v, %v", group.ID, byID, found, err)
+	}
+	if _, found, err := db.GetGroupByID(ctx, group.ID+100); err != nil || found {
+		t.Errorf("GetGroupByID для несуществующей группы = %v, %v", found, err)
+	}
+	chats, err := db.GetChatsForGroup(ctx, "dev")
+	if err != nil {
+		t.Fatalf("GetChatsForGroup: %v", err)
+	}
+	if ids := chatIDs(chats); !equalIDs(ids, []int64{-100}) {
+		t.Errorf("чаты группы: %v", ids)
+	}
+	groups, err := db.GetGroupsForUser(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetGroupsForUser: %v", err)
+	}
+	if names := groupNames(groups); len(names) != 1 || names[0] != "dev" {
+		t.Errorf("группы пользователя: %v", names)
+	}
+
+	// Для несуществующей группы списки пусты
+	users, err := db.GetUsersForGroup(ctx, "missing")
+	if err != nil || len(users) != 0 {
+		t.Errorf("GetUsersForGroup для несуществующей группы: %v, %v", userIDs(users), err)
+	}
+
+	must(t, db.RemoveUserFromGroup(ctx, 1, "dev"))
+	must(t, db.RemoveUsersFromGroup(ctx, []int64{2, 4}, "dev"))
+	users, err = db.GetUsersForGroup(ctx, "dev")
+	if err != nil {
+		t.Fatalf("GetUsersForGroup: %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("участники не удалены из группы: %v", userIDs(users))
+	}
+}
+
+func testDeleteChatAndGroup(t *testing.T, ctx context.Context, db interfaces.Database) {
+	has := mustBool(t)
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddGroup(ctx, "dev"))
+	must(t, db.AddUserToChat(ctx, 1, -100))
+	must(t, db.AddUserToGroup(ctx, 1, "dev"))
+	must(t, db.LinkGroupToChat(ctx, "dev", -100))
+
+	must(t, db.DeleteChat(ctx, -100))
+	if has(db.ChatExists(ctx, -100)) {
+		t.Error("удаленный чат существует")
+	}
+	if err := db.AddChat(ctx, -100, "team"); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("добавление удаленного чата вернуло %v", err)
+	}
+	if err := db.SetChatActive(ctx, -100, false); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("изменение удаленного чата вернуло %v", err)
+	}
+	if has(db.GroupLinkedToChat(ctx, "dev", -100)) {
+		t.Error("удаленный чат остался привязан к группе")
+	}
+	deletedChats, err := db.ListDeletedChats(ctx)
+	if err != nil {
+		t.Fatalf("ListDeletedChats: %v", err)
+	}
+	if ids := chatIDs(deletedChats); !equalIDs(ids, []int64{-100}) {
+		t.Errorf("удаленные чаты: %v", ids)
+	}
+	must(t, db.RestoreChat(ctx, -100))
+	chats, err := db.GetChatsForUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetChatsForUser: %v", err)
+	}
+	if !has(db.ChatExists(ctx, -100)) || len(chats) != 0 {
+		t.Errorf("чат восстановлен неверно: участник в чатах %v", chatIDs(chats))
+	}
+	if err := db.RestoreChat(ctx, -100); err == nil {
+		t.Error("повторное восстановление чата не вернуло ошибку")
+	}
+
+	must(t, db.DeleteGroup(ctx, "dev"))
+	if err := db.DeleteGroup(ctx, "missing"); err != nil {
+		t.Errorf("удаление несуществующей группы вернуло ошибку: %v", err)
+	}
+	if has(db.GroupExists(ctx, "dev")) {
+		t.Error("удаленная группа существует")
+	}
+	if err := db.AddGroup(ctx, "dev"); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("добавление удаленной группы вернуло %v", err)
+	}
+	if err := db.AddUserToGroup(ctx, 1, "dev"); !errors.Is(err, interfaces.ErrDeleted) {
+		t.Errorf("добавление в удаленную группу вернуло %v", err)
+	}
+	deletedGroups, err := db.ListDeletedGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListDeletedGroups: %v", err)
+	}
+	if names := groupNames(deletedGroups); len(names) != 1 || names[0] != "dev" {
+		t.Errorf("удаленные группы: %v", names)
+	}
+
+	// Восстановленная группа возвращается без участников
+	must(t, db.RestoreGroup(ctx, "dev"))
+	users, err := db.GetUsersForGroup(ctx, "dev")
+	if err != nil {
+		t.Fatalf("GetUsersForGroup: %v", err)
+	}
+	if !has(db.GroupExists(ctx, "dev")) || len(users) != 0 {
+		t.Errorf("группа восстановлена неверно: участники %v", userIDs(users))
+	}
+	if err := db.RestoreGroup(ctx, "dev"); err == nil {
+		t.Error("восстановление существующей группы не вернуло ошибку")
+	}
+
+	must(t, db.PurgeGroup(ctx, "dev"))
+	if err := db.PurgeGroup(ctx, "dev"); err == nil {
+		t.Error("повторное окончательное удаление группы не вернуло ошибку")
+	}
+	if err := db.AddGroup(ctx, "dev"); err != nil {
+		t.Errorf("группа не добавляется после окончательного удаления: %v", err)
+	}
+}
+
+func testPurge(t *testing.T, ctx context.Context, db interfaces.Database) {
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddUser(ctx, 2, "bob", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.UpsertUser(ctx, &models.User{UserID: 1, Username: "alice2"}))
+	must(t, db.GrantRole(ctx, 1, models.RoleAdmin, 0))
+	must(t, db.GrantRole(ctx, 2, models.RoleAdmin, -100))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 1, ChatID: models.GlobalMuteChatID}))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 2, ChatID: -100}))
+
+	// Удаление сохраняет роли и историю, окончательное удаление убирает их
+	must(t, db.DeleteUser(ctx, 1))
+	if roles, _ := db.GetUserRoles(ctx, 1); len(roles) != 1 {
+		t.Errorf("роли удаленного пользователя: %+v", roles)
+	}
+	must(t, db.PurgeUser(ctx, 1))
+	history, err := db.GetUsernameHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUsernameHistory: %v", err)
+	}
+	roles, err := db.GetUserRoles(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserRoles: %v", err)
+	}
+	mutes, err := db.GetMentionMutes(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetMentionMutes: %v", err)
+	}
+	if len(history) != 0 || len(roles) != 0 || len(mutes) != 0 {
+		t.Errorf("данные пользователя остались: история %+v, роли %+v, отключения %+v", history, roles, mutes)
+	}
+	if err := db.PurgeUser(ctx, 1); err == nil {
+		t.Error("окончательное удаление несуществующего пользователя не вернуло ошибку")
+	}
+
+	must(t, db.PurgeChat(ctx, -100))
+	roles, err = db.GetUserRoles(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetUserRoles: %v", err)
+	}
+	mutes, err = db.GetMentionMutes(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetMentionMutes: %v", err)
+	}
+	if len(roles) != 0 || len(mutes) != 0 {
+		t.Errorf("данные чата остались: роли %+v, отключения %+v", roles, mutes)
+	}
+	if err := db.PurgeChat(ctx, -100); err == nil {
+		t.Error("окончательное удаление несуществующего чата не вернуло ошибку")
+	}
+	if err := db.AddChat(ctx, -100, "team"); err != nil {
+		t.Errorf("чат не добавляется после окончательного удаления: %v", err)
+	}
+}
+
+func testMentionMutes(t *testing.T, ctx context.Context, db interfaces.Database) {
+	for _, id := range []int64{1, 2, 3, 4} {
+		must(t, db.AddUser(ctx, id, "", "", ""))
+	}
+	must(t, db.AddChat(ctx, -100, "team"))
+	must(t, db.AddChat(ctx, -200, "other"))
+	for _, id := range []int64{1, 2, 3, 4} {
+		must(t, db.AddUserToChat(ctx, id, -100))
+	}
+
+	// Окна тишины задаются относительно текущего времени, чтобы не зависеть от времени запуска
+	now := time.Now().UTC()
+	clock := func(d time.Duration) string { return now.Add(d).Format("15:04") }
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 1, ChatID: models.GlobalMuteChatID}))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 2, ChatID: -100, QuietFrom: clock(-time.Hour), QuietTo: clock(time.Hour), Timezone: "UTC"}))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 3, ChatID: -100, QuietFrom: clock(time.Hour), QuietTo: clock(2 * time.Hour), Timezone: "UTC"}))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 4, ChatID: -200}))
+
+	users, err := db.GetUsersForMention(ctx, -100, "")
+	if err != nil {
+		t.Fatalf("GetUsersForMention: %v", err)
+	}
+	if ids := userIDs(users); !equalIDs(ids, []int64{3, 4}) {
+		t.Errorf("упоминание с отключениями: %v", ids)
+	}
+
+	mutes, err := db.GetMentionMutesForChat(ctx, -100)
+	if err != nil {
+		t.Fatalf("GetMentionMutesForChat: %v", err)
+	}
+	var muted []int64
+	for _, mute := range mutes {
+		muted = append(muted, mute.UserID)
+	}
+	if !equalIDs(muted, []int64{1, 2, 3}) {
+		t.Errorf("отключения в чате: %v", muted)
+	}
+
+	// Повторное отключение заменяет предыдущее
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 4, ChatID: -100}))
+	must(t, db.MuteMentions(ctx, &models.MentionMute{UserID: 4, ChatID: -100, QuietFrom: "22:00", QuietTo: "08:00"}))
+	mutes, err = db.GetMentionMutes(ctx, 4)
+	if err != nil {
+		t.Fatalf("GetMentionMutes: %v", err)
+	}
+	if len(mutes) != 2 || mutes[0].ChatID != -200 || mutes[1].ChatID != -100 || mutes[1].QuietFrom != "22:00" {
+		t.Errorf("отключения пользователя: %+v", mutes)
+	}
+
+	must(t, db.UnmuteMentions(ctx, 1, models.GlobalMuteChatID))
+	must(t, db.UnmuteMentions(ctx, 1, models.GlobalMuteChatID))
+	if mutes, _ := db.GetMentionMutes(ctx, 1); len(mutes) != 0 {
+		t.Errorf("отключение не снято: %+v", mutes)
+	}
+
+	if err := db.MuteMentions(ctx, &models.MentionMute{UserID: 5, ChatID: -100}); err == nil {
+		t.Error("отключение для несуществующего пользователя не вернуло ошибку")
+	}
+	if err := db.MuteMentions(ctx, &models.MentionMute{UserID: 1, ChatID: -100, QuietFrom: "25:00", QuietTo: "08:00"}); err == nil {
+		t.Error("неверное время не вернуло ошибку")
+	}
+	if err := db.MuteMentions(ctx, &models.MentionMute{UserID: 1, ChatID: -100, Timezone: "Mars/Base"}); err == nil {
+		t.Error("неизвестный часовой пояс не вернул ошибку")
+	}
+}
+
+func testRoles(t *testing.T, ctx context.Context, db interfaces.Database) {
+	must(t, db.AddUser(ctx, 1, "alice", "", ""))
+	must(t, db.AddChat(ctx, -100, "team"))
+
+	must(t, db.GrantRole(ctx, 1, models.RoleModerator, -100))
+	must(t, db.GrantRole(ctx, 1, models.RoleAdmin, 0))
+	if err := db.GrantRole(ctx, 1, models.RoleAdmin, 0); err != nil {
+		t.Errorf("повторная выдача роли вернула ошибку: %v", err)
+	}
+	if err := db.GrantRole(ctx, 1, models.RoleAdmin, -200); err == nil {
+		t.Error("выдача роли в несуществующем чате не вернула ошибку")
+	}
+
+	roles, err := db.GetUserRoles(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserRoles: %v", err)
+	}
+	if len(roles) != 2 || roles[0].ChatID != -100 || roles[0].Role != models.RoleModerator || roles[1].Role != models.RoleAdmin {
+		t.Errorf("роли пользователя: %+v", roles)
+	}
+
+	must(t, db.RevokeRole(ctx, 1, models.RoleAdmin, 0))
+	if err := db.RevokeRole(ctx, 1, models.RoleAdmin, 0); err == nil {
+		t.Error("отзыв отсутствующей роли не вернул ошибку")
+	}
+	roles, err = db.ListRoles(ctx)
+	if err != nil {
+		t.Fatalf("ListRoles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].Role != models.RoleModerator {
+		t.Errorf("все роли: %+v", roles)
+	}
+}
+
+func testCommandUsage(t *testing.T, ctx context.Context, db interfaces.Database) {
+	if _, ok, err := db.GetLastCommandUse(ctx, "all", -100, 1); err != nil || ok {
+		t.Errorf("найдено использование команды, которую не вызывали: %v", err)
+	}
+
+	first := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	must(t, db.RecordCommandUse(ctx, "all", -100, 1, first))
+	must(t, db.RecordCommandUse(ctx, "all", -100, 1, first.Add(time.Minute)))
+	must(t, db.RecordCommandUse(ctx, "all", -100, 0, first))
+
+	usedAt, ok, err := db.GetLastCommandUse(ctx, "all", -100, 1)
+	if err != nil || !ok || !usedAt.Equal(first.Add(time.Minute)) {
+		t.Errorf("последнее использование команды: %v, %v, %v", usedAt, ok, err)
+	}
+	usedAt, ok, err = db.GetLastCommandUse(ctx, "all", -100, 0)
+	if err != nil || !ok || !usedAt.Equal(first) {
+		t.Errorf("последнее использование команды в чате: %v, %v, %v", usedAt, ok, err)
+	}
+	if _, ok, err := db.GetLastCommandUse(ctx, "all", -200, 1); err != nil || ok {
+		t.Errorf("использование команды найдено в другом чате: %v", err)
+	}
+}
+
+func testConversations(t *testing.T, ctx context.Context, db interfaces.Database) {
+	if _, ok, err := db.GetConversation(ctx, 1); err != nil || ok {
+		t.Errorf("найден несуществующий диалог: %v", err)
+	}
+
+	expires := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	must(t, db.SaveConversation(ctx, &models.Conversation{UserID: 1, ChatID: -100, Flow: "add", Step: 1, ExpiresAt: expires}))
+	must(t, db.SaveConversation(ctx, &models.Conversation{UserID: 1, ChatID: -100, Flow: "add", Step: 2, Data: "dev", ExpiresAt: expires.Add(time.Minute)}))
+
+	conversation, ok, err := db.GetConversation(ctx, 1)
+	if err != nil || !ok {
+		t.Fatalf("диалог не найден: %v", err)
+	}
+	if conversation.Step != 2 || conversation.Data != "dev" || !conversation.ExpiresAt.Equal(expires.Add(time.Minute)) {
+		t.Errorf("диалог не обновлен: %+v", conversation)
+	}
+
+	must(t, db.DeleteConversation(ctx, 1))
+	if _, ok, err := db.GetConversation(ctx, 1); err != nil || ok {
+		t.Errorf("диалог не удален: %v", err)
+	}
+}
@@ -0,0 +1,1122 @@
+// Package dbtest содержит реализацию interfaces.Database в памяти для тестов.
+// Пакет импортируется только из _test.go файлов и не попадает в сборку бота.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"weveryone_bot_v2/interfaces"
+	"weveryone_bot_v2/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryDB - реализация interfaces.Database в памяти с тем же поведением, что и у database.GormDB.
+// Используется в тестах бота и проходит те же проверки контракта, что и SQL-базы.
+// Удаленные записи, как и в GORM, отмечаются полем DeletedAt.
+type MemoryDB struct {
+	mu sync.Mutex
+
+	users       map[int64]*models.User
+	chats       map[int64]*models.Chat
+	groups      map[uint]*models.Group
+	nextGroupID uint
+
+	userChats  map[[2]int64]bool
+	userGroups map[memberKey]bool
+	groupChats map[memberKey]bool
+
+	history       []models.UsernameHistory
+	mutes         map[[2]int64]models.MentionMute
+	usages        map[models.CommandUsage]time.Time
+	roles         map[models.UserRole]bool
+	conversations map[int64]models.Conversation
+}
+
+// memberKey - связь пользователя или чата (id) с группой
+type memberKey struct {
+	id      int64
+	groupID uint
+}
+
+// Проверяем, что MemoryDB реализует интерфейс Database
+var _ interfaces.Database = (*MemoryDB)(nil)
+
+// NewMemoryDB создает пустую базу в памяти
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:         make(map[int64]*models.User),
+		chats:         make(map[int64]*models.Chat),
+		groups:        make(map[uint]*models.Group),
+		userChats:     make(map[[2]int64]bool),
+		userGroups:    make(map[memberKey]bool),
+		groupChats:    make(map[memberKey]bool),
+		mutes:         make(map[[2]int64]models.MentionMute),
+		usages:        make(map[models.CommandUsage]time.Time),
+		roles:         make(map[models.UserRole]bool),
+		conversations: make(map[int64]models.Conversation),
+	}
+}
+
+// lock захватывает базу. Как и запросы GORM, методы не выполняются с истекшим контекстом.
+func (m *MemoryDB) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	return nil
+}
+
+// deletedNow возвращает отметку об удалении с текущим временем
+func deletedNow() gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+// user возвращает неудаленного пользователя или nil
+func (m *MemoryDB) user(userID int64) *models.User {
+	if user, ok := m.users[userID]; ok && !user.DeletedAt.Valid {
+		return user
+	}
+	return nil
+}
+
+// chat возвращает неудаленный чат или nil
+func (m *MemoryDB) chat(chatID int64) *models.Chat {
+	if chat, ok := m.chats[chatID]; ok && !chat.DeletedAt.Valid {
+		return chat
+	}
+	return nil
+}
+
+// group возвращает группу по названию или nil. При unscoped учитываются и удаленные группы.
+func (m *MemoryDB) group(name string, unscoped bool) *models.Group {
+	for _, group := range m.groups {
+		if group.Name == name && (unscoped || !group.DeletedAt.Valid) {
+			return group
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) checkUser(userID int64) error {
+	if m.user(userID) != nil {
+		return nil
+	}
+	if _, ok := m.users[userID]; ok {
+		return fmt.Errorf("пользователь %d: %w", userID, interfaces.ErrDeleted)
+	}
+	return fmt.Errorf("пользователь не найден: %d", userID)
+}
+
+func (m *MemoryDB) checkChat(chatID int64) error {
+	if m.chat(chatID) != nil {
+		return nil
+	}
+	if _, ok := m.chats[chatID]; ok {
+		return fmt.Errorf("чат %d: %w", chatID, interfaces.ErrDeleted)
+	}
+	return fmt.Errorf("чат не найден: %d", chatID)
+}
+
+func (m *MemoryDB) findGroup(name string) (uint, error) {
+	if group := m.group(name, false); group != nil {
+		return group.ID, nil
+	}
+	if m.group(name, true) != nil {
+		return 0, fmt.Errorf("группа %s: %w", name, interfaces.ErrDeleted)
+	}
+	return 0, fmt.Errorf("группа не найдена: %s", name)
+}
+
+// groupID возвращает ID неудаленной группы или 0
+func (m *MemoryDB) groupID(name string) uint {
+	if group := m.group(name, false); group != nil {
+		return group.ID
+	}
+	return 0
+}
+
+// sortedUsers возвращает копии пользователей, отобранных keep, по возрастанию user_id
+func (m *MemoryDB) sortedUsers(keep func(user *models.User) bool) []models.User {
+	var users []models.User
+	for _, user := range m.users {
+		if keep(user) {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+// sortedChats возвращает копии чатов, отобранных keep, по возрастанию chat_id
+func (m *MemoryDB) sortedChats(keep func(chat *models.Chat) bool) []models.Chat {
+	var chats []models.Chat
+	for _, chat := range m.chats {
+		if keep(chat) {
+			chats = append(chats, *chat)
+		}
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].ChatID < chats[j].ChatID })
+	return chats
+}
+
+// sortedGroups возвращает копии групп, отобранных keep, по названию
+func (m *MemoryDB) sortedGroups(keep func(group *models.Group) bool) []models.Group {
+	var groups []models.Group
+	for _, group := range m.groups {
+		if keep(group) {
+			groups = append(groups, *group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// deleteUserRelations удаляет связи пользователя, а при purge - и его данные
+func (m *MemoryDB) deleteUserRelations(userID int64, purge bool) {
+	for key := range m.userChats {
+		if key[0] == userID {
+			delete(m.userChats, key)
+		}
+	}
+	for key := range m.userGroups {
+		if key.id == userID {
+			delete(m.userGroups, key)
+		}
+	}
+	delete(m.conversations, userID)
+	if !purge {
+		return
+	}
+
+	for key := range m.mutes {
+		if key[0] == userID {
+			delete(m.mutes, key)
+		}
+	}
+	for role := range m.roles {
+		if role.UserID == userID {
+			delete(m.roles, role)
+		}
+	}
+	var history []models.UsernameHistory
+	for _, entry := range m.history {
+		if entry.UserID != userID {
+			history = append(history, entry)
+		}
+	}
+	m.history = history
+	for usage := range m.usages {
+		if usage.UserID == userID {
+			delete(m.usages, usage)
+		}
+	}
+}
+
+// deleteChatRelations удаляет связи чата, а при purge - и его данные
+func (m *MemoryDB) deleteChatRelations(chatID int64, purge bool) {
+	for key := range m.userChats {
+		if key[1] == chatID {
+			delete(m.userChats, key)
+		}
+	}
+	for key := range m.groupChats {
+		if key.id == chatID {
+			delete(m.groupChats, key)
+		}
+	}
+	if !purge {
+		return
+	}
+
+	for key := range m.mutes {
+		if key[1] == chatID {
+			delete(m.mutes, key)
+		}
+	}
+	for role := range m.roles {
+		if role.ChatID == chatID {
+			delete(m.roles, role)
+		}
+	}
+	for usage := range m.usages {
+		if usage.ChatID == chatID {
+			delete(m.usages, usage)
+		}
+	}
+	for userID, conversation := range m.conversations {
+		if conversation.ChatID == chatID {
+			delete(m.conversations, userID)
+		}
+	}
+}
+
+// deleteGroupRelations удаляет участников группы и ее привязки к чатам
+func (m *MemoryDB) deleteGroupRelations(groupID uint) {
+	for key := range m.userGroups {
+		if key.groupID == groupID {
+			delete(m.userGroups, key)
+		}
+	}
+	for key := range m.groupChats {
+		if key.groupID == groupID {
+			delete(m.groupChats, key)
+		}
+	}
+}
+
+func (m *MemoryDB) AddUser(ctx context.Context, userID int64, username, firstName, lastName string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; ok {
+		return m.checkUser(userID)
+	}
+	m.users[userID] = &models.User{UserID: userID, Username: username, FirstName: firstName, LastName: lastName}
+	return nil
+}
+
+func (m *MemoryDB) UpsertUser(ctx context.Context, user *models.User) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	existing, ok := m.users[user.UserID]
+	if !ok {
+		m.users[user.UserID] = &models.User{
+			UserID:       user.UserID,
+			Username:     user.Username,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			LanguageCode: user.LanguageCode,
+		}
+		return nil
+	}
+	if existing.DeletedAt.Valid {
+		return nil
+	}
+
+	if !existing.UsernameLocked {
+		m.setUsername(existing, user.Username)
+	}
+	existing.FirstName = user.FirstName
+	existing.LastName = user.LastName
+	existing.LanguageCode = user.LanguageCode
+	return nil
+}
+
+func (m *MemoryDB) SetUsername(ctx context.Context, userID int64, username string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkUser(userID); err != nil {
+		return err
+	}
+	user := m.users[userID]
+	m.setUsername(user, username)
+	user.UsernameLocked = true
+	return nil
+}
+
+// setUsername меняет username пользователя, сохраняя прежний в историю
+func (m *MemoryDB) setUsername(user *models.User, username string) {
+	if user.Username != "" && user.Username != username {
+		m.history = append(m.history, models.UsernameHistory{
+			ID:        uint(len(m.history) + 1),
+			UserID:    user.UserID,
+			Username:  user.Username,
+			ChangedAt: time.Now(),
+		})
+	}
+	user.Username = username
+}
+
+func (m *MemoryDB) GetUsernameHistory(ctx context.Context, userID int64) ([]models.UsernameHistory, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var history []models.UsernameHistory
+	for i := len(m.history) - 1; i >= 0; i-- {
+		if m.history[i].UserID == userID {
+			history = append(history, m.history[i])
+		}
+	}
+	return history, nil
+}
+
+func (m *MemoryDB) DeleteUser(ctx context.Context, userID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if user := m.user(userID); user != nil {
+		user.DeletedAt = deletedNow()
+	}
+	m.deleteUserRelations(userID, false)
+	return nil
+}
+
+func (m *MemoryDB) ListUsers(ctx context.Context) ([]models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedUsers(func(user *models.User) bool { return !user.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) UserExists(ctx context.Context, userID int64) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+	return m.user(userID) != nil, nil
+}
+
+func (m *MemoryDB) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	user := m.user(userID)
+	if user == nil {
+		return nil, fmt.Errorf("пользователь не найден: %d", userID)
+	}
+	result := *user
+	return &result, nil
+}
+
+func (m *MemoryDB) GetChatsForUser(ctx context.Context, userID int64) ([]models.Chat, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedChats(func(chat *models.Chat) bool {
+		return !chat.DeletedAt.Valid && m.userChats[[2]int64{userID, chat.ChatID}]
+	}), nil
+}
+
+func (m *MemoryDB) GetGroupsForUser(ctx context.Context, userID int64) ([]models.Group, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedGroups(func(group *models.Group) bool {
+		return !group.DeletedAt.Valid && m.userGroups[memberKey{userID, group.ID}]
+	}), nil
+}
+
+func (m *MemoryDB) AddChat(ctx context.Context, chatID int64, title string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if _, ok := m.chats[chatID]; ok {
+		return m.checkChat(chatID)
+	}
+	m.chats[chatID] = &models.Chat{ChatID: chatID, Title: title, Active: true}
+	return nil
+}
+
+func (m *MemoryDB) DeleteChat(ctx context.Context, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if chat := m.chat(chatID); chat != nil {
+		chat.DeletedAt = deletedNow()
+	}
+	m.deleteChatRelations(chatID, false)
+	return nil
+}
+
+func (m *MemoryDB) SetChatActive(ctx context.Context, chatID int64, active bool) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkChat(chatID); err != nil {
+		return err
+	}
+	m.chats[chatID].Active = active
+	return nil
+}
+
+func (m *MemoryDB) SetChatTitle(ctx context.Context, chatID int64, title string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkChat(chatID); err != nil {
+		return err
+	}
+	m.chats[chatID].Title = title
+	return nil
+}
+
+func (m *MemoryDB) ListChats(ctx context.Context) ([]models.Chat, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedChats(func(chat *models.Chat) bool { return !chat.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) ChatExists(ctx context.Context, chatID int64) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+	return m.chat(chatID) != nil, nil
+}
+
+func (m *MemoryDB) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	chat := m.chat(chatID)
+	if chat == nil {
+		return nil, fmt.Errorf("чат не найден: %d", chatID)
+	}
+	result := *chat
+	return &result, nil
+}
+
+func (m *MemoryDB) GetUsersForMention(ctx context.Context, chatID int64, groupName string) ([]models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	groupID := m.groupID(groupName)
+	users := m.sortedUsers(func(user *models.User) bool {
+		if user.DeletedAt.Valid || !m.userChats[[2]int64{user.UserID, chatID}] {
+			return false
+		}
+		if groupName == "" {
+			return true
+		}
+		// Группа учитывается только если она привязана к этому чату
+		return groupID != 0 && m.groupChats[memberKey{chatID, groupID}] && m.userGroups[memberKey{user.UserID, groupID}]
+	})
+
+	now := time.Now()
+	var result []models.User
+	for _, user := range users {
+		muted := false
+		for _, key := range [][2]int64{{user.UserID, chatID}, {user.UserID, models.GlobalMuteChatID}} {
+			if mute, ok := m.mutes[key]; ok && mute.ActiveAt(now) {
+				muted = true
+			}
+		}
+		if !muted {
+			result = append(result, user)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) GetGroupsForChat(ctx context.Context, chatID int64) ([]models.Group, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedGroups(func(group *models.Group) bool {
+		return !group.DeletedAt.Valid && m.groupChats[memberKey{chatID, group.ID}]
+	}), nil
+}
+
+func (m *MemoryDB) AddGroup(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if m.group(name, true) != nil {
+		_, err := m.findGroup(name)
+		return err
+	}
+	m.nextGroupID++
+	m.groups[m.nextGroupID] = &models.Group{Model: gorm.Model{ID: m.nextGroupID}, Name: name}
+	return nil
+}
+
+func (m *MemoryDB) DeleteGroup(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	group := m.group(name, false)
+	if group == nil {
+		return nil
+	}
+	group.DeletedAt = deletedNow()
+	m.deleteGroupRelations(group.ID)
+	return nil
+}
+
+func (m *MemoryDB) RenameGroup(ctx context.Context, oldName, newName string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	group := m.group(oldName, false)
+	if group == nil {
+		return fmt.Errorf("группа не найдена: %s", oldName)
+	}
+	if existing := m.group(newName, true); existing != nil {
+		if existing.DeletedAt.Valid {
+			return fmt.Errorf("группа %s: %w", newName, interfaces.ErrDeleted)
+		}
+		return fmt.Errorf("группа %s уже существует", newName)
+	}
+	group.Name = newName
+	return nil
+}
+
+func (m *MemoryDB) ListGroups(ctx context.Context) ([]models.Group, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedGroups(func(group *models.Group) bool { return !group.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) GroupExists(ctx context.Context, name string) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+	return m.group(name, false) != nil, nil
+}
+
+func (m *MemoryDB) GetGroup(ctx context.Context, name string) (*models.Group, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	group := m.group(name, false)
+	if group == nil {
+		return nil, fmt.Errorf("группа не найдена: %s", name)
+	}
+	result := *group
+	return &result, nil
+}
+
+func (m *MemoryDB) GetGroupByID(ctx context.Context, id uint) (*models.Group, bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer m.mu.Unlock()
+	group, ok := m.groups[id]
+	if !ok || group.DeletedAt.Valid {
+		return nil, false, nil
+	}
+	result := *group
+	return &result, true, nil
+}
+
+func (m *MemoryDB) GetChatsForGroup(ctx context.Context, groupName string) ([]models.Chat, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	groupID := m.groupID(groupName)
+	if groupID == 0 {
+		return nil, nil
+	}
+	return m.sortedChats(func(chat *models.Chat) bool {
+		return !chat.DeletedAt.Valid && m.groupChats[memberKey{chat.ChatID, groupID}]
+	}), nil
+}
+
+func (m *MemoryDB) GetUsersForGroup(ctx context.Context, groupName string) ([]models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	groupID := m.groupID(groupName)
+	if groupID == 0 {
+		return nil, nil
+	}
+	return m.sortedUsers(func(user *models.User) bool {
+		return !user.DeletedAt.Valid && m.userGroups[memberKey{user.UserID, groupID}]
+	}), nil
+}
+
+func (m *MemoryDB) AddUserToChat(ctx context.Context, userID int64, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkUser(userID); err != nil {
+		return err
+	}
+	if err := m.checkChat(chatID); err != nil {
+		return err
+	}
+	key := [2]int64{userID, chatID}
+	if m.userChats[key] {
+		return fmt.Errorf("пользователь уже существует в этом чате")
+	}
+	m.userChats[key] = true
+	return nil
+}
+
+func (m *MemoryDB) RemoveUserFromChat(ctx context.Context, userID int64, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.userChats, [2]int64{userID, chatID})
+	return nil
+}
+
+func (m *MemoryDB) RemoveUsersFromChat(ctx context.Context, userIDs []int64, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	for _, userID := range userIDs {
+		delete(m.userChats, [2]int64{userID, chatID})
+	}
+	return nil
+}
+
+func (m *MemoryDB) AddUserToGroup(ctx context.Context, userID int64, groupName string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkUser(userID); err != nil {
+		return err
+	}
+	groupID, err := m.findGroup(groupName)
+	if err != nil {
+		return err
+	}
+	m.userGroups[memberKey{userID, groupID}] = true
+	return nil
+}
+
+func (m *MemoryDB) RemoveUserFromGroup(ctx context.Context, userID int64, groupName string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.userGroups, memberKey{userID, m.groupID(groupName)})
+	return nil
+}
+
+func (m *MemoryDB) RemoveUsersFromGroup(ctx context.Context, userIDs []int64, groupName string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	groupID := m.groupID(groupName)
+	for _, userID := range userIDs {
+		delete(m.userGroups, memberKey{userID, groupID})
+	}
+	return nil
+}
+
+func (m *MemoryDB) LinkGroupToChat(ctx context.Context, groupName string, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	groupID, err := m.findGroup(groupName)
+	if err != nil {
+		return err
+	}
+	if err := m.checkChat(chatID); err != nil {
+		return err
+	}
+	m.groupChats[memberKey{chatID, groupID}] = true
+	return nil
+}
+
+func (m *MemoryDB) UnlinkGroupFromChat(ctx context.Context, groupName string, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.groupChats, memberKey{chatID, m.groupID(groupName)})
+	return nil
+}
+
+func (m *MemoryDB) GroupLinkedToChat(ctx context.Context, groupName string, chatID int64) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+	groupID := m.groupID(groupName)
+	return groupID != 0 && m.groupChats[memberKey{chatID, groupID}], nil
+}
+
+func (m *MemoryDB) GetUsersForChat(ctx context.Context, chatID int64) ([]models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	if m.chat(chatID) == nil {
+		return nil, nil
+	}
+	return m.sortedUsers(func(user *models.User) bool {
+		return !user.DeletedAt.Valid && m.userChats[[2]int64{user.UserID, chatID}]
+	}), nil
+}
+
+func (m *MemoryDB) AddUsersToChat(ctx context.Context, userIDs []int64, chatID int64) (models.BulkResult, error) {
+	if err := m.lock(ctx); err != nil {
+		return models.BulkResult{}, err
+	}
+	defer m.mu.Unlock()
+	if err := m.checkChat(chatID); err != nil {
+		return models.BulkResult{}, err
+	}
+	return m.addUsersBulk(userIDs, func(userID int64) bool {
+		key := [2]int64{userID, chatID}
+		if m.userChats[key] {
+			return false
+		}
+		m.userChats[key] = true
+		return true
+	}), nil
+}
+
+func (m *MemoryDB) AddUsersToGroup(ctx context.Context, userIDs []int64, groupName string) (models.BulkResult, error) {
+	if err := m.lock(ctx); err != nil {
+		return models.BulkResult{}, err
+	}
+	defer m.mu.Unlock()
+	groupID, err := m.findGroup(groupName)
+	if err != nil {
+		return models.BulkResult{}, err
+	}
+	return m.addUsersBulk(userIDs, func(userID int64) bool {
+		key := memberKey{userID, groupID}
+		if m.userGroups[key] {
+			return false
+		}
+		m.userGroups[key] = true
+		return true
+	}), nil
+}
+
+// addUsersBulk добавляет связи через add, который возвращает false для уже существующей связи.
+// Повторы пропускаются, неизвестные и удаленные пользователи попадают в Unknown.
+func (m *MemoryDB) addUsersBulk(userIDs []int64, add func(userID int64) bool) models.BulkResult {
+	var result models.BulkResult
+	seen := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		switch {
+		case m.user(userID) == nil:
+			result.Unknown = append(result.Unknown, userID)
+		case add(userID):
+			result.Added = append(result.Added, userID)
+		default:
+			result.Existing = append(result.Existing, userID)
+		}
+	}
+	return result
+}
+
+func (m *MemoryDB) ListDeletedUsers(ctx context.Context) ([]models.User, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedUsers(func(user *models.User) bool { return user.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) ListDeletedChats(ctx context.Context) ([]models.Chat, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedChats(func(chat *models.Chat) bool { return chat.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) ListDeletedGroups(ctx context.Context) ([]models.Group, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedGroups(func(group *models.Group) bool { return group.DeletedAt.Valid }), nil
+}
+
+func (m *MemoryDB) RestoreUser(ctx context.Context, userID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok || !user.DeletedAt.Valid {
+		return fmt.Errorf("удаленный пользователь не найден: %d", userID)
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (m *MemoryDB) RestoreChat(ctx context.Context, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	chat, ok := m.chats[chatID]
+	if !ok || !chat.DeletedAt.Valid {
+		return fmt.Errorf("удаленный чат не найден: %d", chatID)
+	}
+	chat.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (m *MemoryDB) RestoreGroup(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if m.group(name, false) != nil {
+		return fmt.Errorf("группа %s уже существует", name)
+	}
+	group := m.group(name, true)
+	if group == nil {
+		return fmt.Errorf("удаленная группа не найдена: %s", name)
+	}
+	group.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (m *MemoryDB) PurgeUser(ctx context.Context, userID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	_, found := m.users[userID]
+	delete(m.users, userID)
+	m.deleteUserRelations(userID, true)
+	if !found {
+		return fmt.Errorf("пользователь не найден: %d", userID)
+	}
+	return nil
+}
+
+func (m *MemoryDB) PurgeChat(ctx context.Context, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	_, found := m.chats[chatID]
+	delete(m.chats, chatID)
+	m.deleteChatRelations(chatID, true)
+	if !found {
+		return fmt.Errorf("чат не найден: %d", chatID)
+	}
+	return nil
+}
+
+func (m *MemoryDB) PurgeGroup(ctx context.Context, name string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	group := m.group(name, true)
+	if group == nil {
+		return fmt.Errorf("группа не найдена: %s", name)
+	}
+	delete(m.groups, group.ID)
+	m.deleteGroupRelations(group.ID)
+	return nil
+}
+
+func (m *MemoryDB) MuteMentions(ctx context.Context, mute *models.MentionMute) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if m.user(mute.UserID) == nil {
+		return fmt.Errorf("пользователь не найден: %d", mute.UserID)
+	}
+	if mute.HasWindow() {
+		if _, err := models.ParseClock(mute.QuietFrom); err != nil {
+			return err
+		}
+		if _, err := models.ParseClock(mute.QuietTo); err != nil {
+			return err
+		}
+	}
+	if mute.Timezone != "" {
+		if _, err := time.LoadLocation(mute.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс: %s", mute.Timezone)
+		}
+	}
+	m.mutes[[2]int64{mute.UserID, mute.ChatID}] = *mute
+	return nil
+}
+
+func (m *MemoryDB) UnmuteMentions(ctx context.Context, userID int64, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.mutes, [2]int64{userID, chatID})
+	return nil
+}
+
+func (m *MemoryDB) GetMentionMutes(ctx context.Context, userID int64) ([]models.MentionMute, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var mutes []models.MentionMute
+	for key, mute := range m.mutes {
+		if key[0] == userID {
+			mutes = append(mutes, mute)
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool { return mutes[i].ChatID < mutes[j].ChatID })
+	return mutes, nil
+}
+
+func (m *MemoryDB) GetMentionMutesForChat(ctx context.Context, chatID int64) ([]models.MentionMute, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var mutes []models.MentionMute
+	for key, mute := range m.mutes {
+		if key[1] == chatID || (mute.IsGlobal() && m.userChats[[2]int64{key[0], chatID}]) {
+			mutes = append(mutes, mute)
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		if mutes[i].UserID != mutes[j].UserID {
+			return mutes[i].UserID < mutes[j].UserID
+		}
+		return mutes[i].ChatID < mutes[j].ChatID
+	})
+	return mutes, nil
+}
+
+func (m *MemoryDB) GetLastCommandUse(ctx context.Context, command string, chatID int64, userID int64) (time.Time, bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return time.Time{}, false, err
+	}
+	defer m.mu.Unlock()
+	usedAt, ok := m.usages[models.CommandUsage{Command: command, ChatID: chatID, UserID: userID}]
+	return usedAt, ok, nil
+}
+
+func (m *MemoryDB) RecordCommandUse(ctx context.Context, command string, chatID int64, userID int64, usedAt time.Time) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	m.usages[models.CommandUsage{Command: command, ChatID: chatID, UserID: userID}] = usedAt
+	return nil
+}
+
+func (m *MemoryDB) GrantRole(ctx context.Context, userID int64, role string, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if chatID != 0 && m.chat(chatID) == nil {
+		return fmt.Errorf("чат не найден: %d", chatID)
+	}
+	m.roles[models.UserRole{UserID: userID, Role: role, ChatID: chatID}] = true
+	return nil
+}
+
+func (m *MemoryDB) RevokeRole(ctx context.Context, userID int64, role string, chatID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	key := models.UserRole{UserID: userID, Role: role, ChatID: chatID}
+	if !m.roles[key] {
+		return fmt.Errorf("у пользователя %d нет роли %s", userID, role)
+	}
+	delete(m.roles, key)
+	return nil
+}
+
+func (m *MemoryDB) GetUserRoles(ctx context.Context, userID int64) ([]models.UserRole, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var roles []models.UserRole
+	for _, role := range m.sortedRoles() {
+		if role.UserID == userID {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (m *MemoryDB) ListRoles(ctx context.Context) ([]models.UserRole, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	return m.sortedRoles(), nil
+}
+
+// sortedRoles возвращает роли по user_id, chat_id и названию
+func (m *MemoryDB) sortedRoles() []models.UserRole {
+	var roles []models.UserRole
+	for role := range m.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		a, b := roles[i], roles[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.ChatID != b.ChatID {
+			return a.ChatID < b.ChatID
+		}
+		return a.Role < b.Role
+	})
+	return roles
+}
+
+func (m *MemoryDB) GetConversation(ctx context.Context, userID int64) (*models.Conversation, bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer m.mu.Unlock()
+	conversation, ok := m.conversations[userID]
+	if !ok {
+		return nil, false, nil
+	}
+	return &conversation, true, nil
+}
+
+func (m *MemoryDB) SaveConversation(ctx context.Context, conversation *models.Conversation) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	m.conversations[conversation.UserID] = *conversation
+	return nil
+}
+
+func (m *MemoryDB) DeleteConversation(ctx context.Context, userID int64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.conversations, userID)
+	return nil
+}
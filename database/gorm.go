@@ -0,0 +1,1075 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"weveryone_bot_v2/interfaces"
+	"weveryone_bot_v2/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormDB реализует interfaces.Database поверх GORM и не зависит от конкретной СУБД.
+// Подключения создаются через NewSQLiteDB и NewPostgresDB.
+type GormDB struct {
+	db *gorm.DB
+}
+
+// Проверяем, что GormDB реализует интерфейс Database
+var _ interfaces.Database = (*GormDB)(nil)
+
+// open подключается к базе через dialector. Схема не изменяется: перед работой
+// нужно применить миграции через MigrateUp.
+func open(dialector gorm.Dialector) (*GormDB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы данных: %v", err)
+	}
+	return &GormDB{db: db}, nil
+}
+
+// cascade описывает записи, которые удаляются вместе с сущностью
+type cascade struct {
+	model interface{}
+	query string
+}
+
+var (
+	// Связи удаляются вместе с сущностью, данные - только при окончательном удалении
+	userRelations  = []cascade{{&models.UserChat{}, "user_id = ?"}, {&models.UserGroup{}, "user_id = ?"}, {&models.Conversation{}, "user_id = ?"}}
+	userData       = []cascade{{&models.MentionMute{}, "user_id = ?"}, {&models.UserRole{}, "user_id = ?"}, {&models.UsernameHistory{}, "user_id = ?"}, {&models.CommandUsage{}, "user_id = ?"}}
+	chatRelations  = []cascade{{&models.UserChat{}, "chat_id = ?"}, {&models.GroupChat{}, "chat_id = ?"}}
+	chatData       = []cascade{{&models.MentionMute{}, "chat_id = ?"}, {&models.UserRole{}, "chat_id = ?"}, {&models.CommandUsage{}, "chat_id = ?"}, {&models.Conversation{}, "chat_id = ?"}}
+	groupRelations = []cascade{{&models.UserGroup{}, "group_id = ?"}, {&models.GroupChat{}, "group_id = ?"}}
+)
+
+// deleteCascade удаляет записи, связанные с сущностью
+func deleteCascade(tx *gorm.DB, value interface{}, cascades ...cascade) error {
+	for _, c := range cascades {
+		if err := tx.Where(c.query, value).Delete(c.model).Error; err != nil {
+			return fmt.Errorf("ошибка удаления связанных записей: %v", err)
+		}
+	}
+	return nil
+}
+
+// isDeleted проверяет, есть ли запись среди удаленных. Внутри транзакции нужно передавать tx,
+// чтобы проверка видела те же данные, что и остальные запросы транзакции.
+func isDeleted(db *gorm.DB, model interface{}, query string, value interface{}) (bool, error) {
+	return exists(db.Unscoped().Where("deleted_at IS NOT NULL"), model, query, value)
+}
+
+// exists проверяет, есть ли записи, подходящие под условие
+func exists(db *gorm.DB, model interface{}, query string, value ...interface{}) (bool, error) {
+	var count int64
+	if err := db.Model(model).Where(query, value...).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// restore снимает отметку об удалении с записи
+func (s *GormDB) restore(ctx context.Context, model interface{}, query string, value interface{}) (bool, error) {
+	result := s.db.WithContext(ctx).Unscoped().Model(model).Where(query, value).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
+	return result.RowsAffected > 0, result.Error
+}
+
+// purge окончательно удаляет запись вместе со связанными записями
+func (s *GormDB) purge(ctx context.Context, model interface{}, query string, value interface{}, cascades ...cascade) (bool, error) {
+	var found bool
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where(query, value).Delete(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		found = result.RowsAffected > 0
+		return deleteCascade(tx, value, cascades...)
+	})
+	return found, err
+}
+
+// checkUser проверяет, что пользователь существует и не удален
+func (s *GormDB) checkUser(ctx context.Context, userID int64) error {
+	if ok, err := s.UserExists(ctx, userID); err != nil || ok {
+		return err
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.User{}, "user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("пользователь %d: %w", userID, interfaces.ErrDeleted)
+	}
+	return fmt.Errorf("пользователь не найден: %d", userID)
+}
+
+// checkChat проверяет, что чат существует и не удален
+func (s *GormDB) checkChat(ctx context.Context, chatID int64) error {
+	if ok, err := s.ChatExists(ctx, chatID); err != nil || ok {
+		return err
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.Chat{}, "chat_id = ?", chatID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("чат %d: %w", chatID, interfaces.ErrDeleted)
+	}
+	return fmt.Errorf("чат не найден: %d", chatID)
+}
+
+// findGroup возвращает ID группы, если она существует и не удалена
+func (s *GormDB) findGroup(ctx context.Context, name string) (uint, error) {
+	var group models.Group
+	err := s.db.WithContext(ctx).Select("id").Where("name = ?", name).First(&group).Error
+	if err == nil {
+		return group.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.Group{}, "name = ?", name)
+	if err != nil {
+		return 0, err
+	}
+	if deleted {
+		return 0, fmt.Errorf("группа %s: %w", name, interfaces.ErrDeleted)
+	}
+	return 0, fmt.Errorf("группа не найдена: %s", name)
+}
+
+// groupIDs возвращает подзапрос с ID неудаленной группы по названию
+func (s *GormDB) groupIDs(ctx context.Context, name string) *gorm.DB {
+	return s.db.WithContext(ctx).Model(&models.Group{}).Select("id").Where("name = ?", name)
+}
+
+// Реализация методов интерфейса Database
+func (s *GormDB) AddUser(ctx context.Context, userID int64, username, firstName, lastName string) error {
+	found, err := s.UserExists(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if found {
+		return nil // Пользователь уже существует
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.User{}, "user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("пользователь %d: %w", userID, interfaces.ErrDeleted)
+	}
+	user := models.User{
+		UserID:    userID,
+		Username:  username,
+		FirstName: firstName,
+		LastName:  lastName,
+	}
+	return s.db.WithContext(ctx).Create(&user).Error
+}
+
+// UpsertUser создает пользователя или обновляет его username, имя и язык.
+// Предыдущий username сохраняется в историю. Удаленные пользователи не восстанавливаются,
+// username, заданный администратором, не перезаписывается.
+func (s *GormDB) UpsertUser(ctx context.Context, user *models.User) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		err := tx.Where("user_id = ?", user.UserID).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			deleted, err := isDeleted(tx, &models.User{}, "user_id = ?", user.UserID)
+			if err != nil || deleted {
+				return err
+			}
+			return tx.Create(&models.User{
+				UserID:       user.UserID,
+				Username:     user.Username,
+				FirstName:    user.FirstName,
+				LastName:     user.LastName,
+				LanguageCode: user.LanguageCode,
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		username := user.Username
+		if existing.UsernameLocked {
+			username = existing.Username
+		}
+		if existing.Username == username &&
+			existing.FirstName == user.FirstName &&
+			existing.LastName == user.LastName &&
+			existing.LanguageCode == user.LanguageCode {
+			return nil // Ничего не изменилось
+		}
+
+		if err := saveUsernameHistory(tx, &existing, username); err != nil {
+			return err
+		}
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"username":      username,
+			"first_name":    user.FirstName,
+			"last_name":     user.LastName,
+			"language_code": user.LanguageCode,
+		}).Error
+	})
+}
+
+// SetUsername задает username пользователя вместо полученного из Telegram.
+// Такой username сохраняется при обновлении данных пользователя через UpsertUser.
+func (s *GormDB) SetUsername(ctx context.Context, userID int64, username string) error {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.User
+		if err := tx.Where("user_id = ?", userID).First(&existing).Error; err != nil {
+			return err
+		}
+		if err := saveUsernameHistory(tx, &existing, username); err != nil {
+			return err
+		}
+		return tx.Model(&existing).Updates(map[string]interface{}{
+			"username":        username,
+			"username_locked": true,
+		}).Error
+	})
+}
+
+// saveUsernameHistory сохраняет в историю прежний username пользователя, если он меняется
+func saveUsernameHistory(tx *gorm.DB, existing *models.User, username string) error {
+	if existing.Username == "" || existing.Username == username {
+		return nil
+	}
+	history := models.UsernameHistory{
+		UserID:   existing.UserID,
+		Username: existing.Username,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return fmt.Errorf("ошибка сохранения истории username: %v", err)
+	}
+	return nil
+}
+
+// GetUsernameHistory возвращает предыдущие username пользователя, начиная с последнего
+func (s *GormDB) GetUsernameHistory(ctx context.Context, userID int64) ([]models.UsernameHistory, error) {
+	var history []models.UsernameHistory
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("changed_at DESC, id DESC").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// DeleteUser помечает пользователя удаленным и удаляет его связи с чатами и группами.
+// Роли, отключения упоминаний и история username хранятся до окончательного удаления.
+func (s *GormDB) DeleteUser(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.User{}).Error; err != nil {
+			return fmt.Errorf("ошибка удаления пользователя: %v", err)
+		}
+		return deleteCascade(tx, userID, userRelations...)
+	})
+}
+
+// ListDeletedUsers возвращает удаленных пользователей, которых можно восстановить
+func (s *GormDB) ListDeletedUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	if err := s.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("user_id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// RestoreUser восстанавливает удаленного пользователя. Связи с чатами и группами не восстанавливаются.
+func (s *GormDB) RestoreUser(ctx context.Context, userID int64) error {
+	restored, err := s.restore(ctx, &models.User{}, "user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("удаленный пользователь не найден: %d", userID)
+	}
+	return nil
+}
+
+// PurgeUser окончательно удаляет пользователя со всеми связями, ролями и историей
+func (s *GormDB) PurgeUser(ctx context.Context, userID int64) error {
+	found, err := s.purge(ctx, &models.User{}, "user_id = ?", userID, append(userRelations, userData...)...)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("пользователь не найден: %d", userID)
+	}
+	return nil
+}
+
+func (s *GormDB) ListUsers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	if err := s.db.WithContext(ctx).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *GormDB) AddChat(ctx context.Context, chatID int64, title string) error {
+	found, err := s.ChatExists(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if found {
+		return nil // Чат уже существует
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.Chat{}, "chat_id = ?", chatID)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("чат %d: %w", chatID, interfaces.ErrDeleted)
+	}
+	chat := models.Chat{
+		ChatID: chatID,
+		Title:  title,
+	}
+	return s.db.WithContext(ctx).Create(&chat).Error
+}
+
+// DeleteChat помечает чат удаленным и удаляет его связи с пользователями и группами.
+// Роли и отключения упоминаний в чате хранятся до окончательного удаления.
+func (s *GormDB) DeleteChat(ctx context.Context, chatID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chat_id = ?", chatID).Delete(&models.Chat{}).Error; err != nil {
+			return fmt.Errorf("ошибка удаления чата: %v", err)
+		}
+		return deleteCascade(tx, chatID, chatRelations...)
+	})
+}
+
+// ListDeletedChats возвращает удаленные чаты, которые можно восстановить
+func (s *GormDB) ListDeletedChats(ctx context.Context) ([]models.Chat, error) {
+	var chats []models.Chat
+	if err := s.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("chat_id").Find(&chats).Error; err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+// RestoreChat восстанавливает удаленный чат. Связи с пользователями и группами не восстанавливаются.
+func (s *GormDB) RestoreChat(ctx context.Context, chatID int64) error {
+	restored, err := s.restore(ctx, &models.Chat{}, "chat_id = ?", chatID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("удаленный чат не найден: %d", chatID)
+	}
+	return nil
+}
+
+// PurgeChat окончательно удаляет чат со всеми связями, ролями и отключениями упоминаний
+func (s *GormDB) PurgeChat(ctx context.Context, chatID int64) error {
+	found, err := s.purge(ctx, &models.Chat{}, "chat_id = ?", chatID, append(chatRelations, chatData...)...)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("чат не найден: %d", chatID)
+	}
+	return nil
+}
+
+// SetChatActive помечает чат активным или неактивным (например, когда бота удалили из чата)
+func (s *GormDB) SetChatActive(ctx context.Context, chatID int64, active bool) error {
+	if err := s.checkChat(ctx, chatID); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&models.Chat{}).Where("chat_id = ?", chatID).Update("active", active).Error
+}
+
+// SetChatTitle изменяет название чата
+func (s *GormDB) SetChatTitle(ctx context.Context, chatID int64, title string) error {
+	if err := s.checkChat(ctx, chatID); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&models.Chat{}).Where("chat_id = ?", chatID).Update("title", title).Error
+}
+
+func (s *GormDB) ListChats(ctx context.Context) ([]models.Chat, error) {
+	var chats []models.Chat
+	if err := s.db.WithContext(ctx).Find(&chats).Error; err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (s *GormDB) AddGroup(ctx context.Context, name string) error {
+	found, err := s.GroupExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if found {
+		return nil // Группа уже существует
+	}
+	deleted, err := isDeleted(s.db.WithContext(ctx), &models.Group{}, "name = ?", name)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return fmt.Errorf("группа %s: %w", name, interfaces.ErrDeleted)
+	}
+	group := models.Group{
+		Name: name,
+	}
+	return s.db.WithContext(ctx).Create(&group).Error
+}
+
+// DeleteGroup помечает группу удаленной и удаляет ее участников и привязки к чатам
+func (s *GormDB) DeleteGroup(ctx context.Context, name string) error {
+	var group models.Group
+	err := s.db.WithContext(ctx).Where("name = ?", name).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&group).Error; err != nil {
+			return fmt.Errorf("ошибка удаления группы: %v", err)
+		}
+		return deleteCascade(tx, group.ID, groupRelations...)
+	})
+}
+
+// ListDeletedGroups возвращает удаленные группы, которые можно восстановить
+func (s *GormDB) ListDeletedGroups(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	if err := s.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// RestoreGroup восстанавливает удаленную группу. Участники и привязки к чатам не восстанавливаются.
+func (s *GormDB) RestoreGroup(ctx context.Context, name string) error {
+	found, err := s.GroupExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("группа %s уже существует", name)
+	}
+	restored, err := s.restore(ctx, &models.Group{}, "name = ?", name)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return fmt.Errorf("удаленная группа не найдена: %s", name)
+	}
+	return nil
+}
+
+// PurgeGroup окончательно удаляет группу вместе с участниками и привязками к чатам
+func (s *GormDB) PurgeGroup(ctx context.Context, name string) error {
+	var group models.Group
+	err := s.db.WithContext(ctx).Unscoped().Where("name = ?", name).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("группа не найдена: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.purge(ctx, &models.Group{}, "id = ?", group.ID, groupRelations...)
+	return err
+}
+
+// RenameGroup переименовывает группу. Участники и привязки к чатам ссылаются на ID группы и не меняются.
+// Название удаленной группы занято до ее окончательного удаления: переименование в него
+// возвращает interfaces.ErrDeleted.
+func (s *GormDB) RenameGroup(ctx context.Context, oldName, newName string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		found, err := exists(tx, &models.Group{}, "name = ?", oldName)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("группа не найдена: %s", oldName)
+		}
+		taken, err := exists(tx, &models.Group{}, "name = ?", newName)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return fmt.Errorf("группа %s уже существует", newName)
+		}
+		deleted, err := isDeleted(tx, &models.Group{}, "name = ?", newName)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			return fmt.Errorf("группа %s: %w", newName, interfaces.ErrDeleted)
+		}
+
+		if err := tx.Model(&models.Group{}).Where("name = ?", oldName).Update("name", newName).Error; err != nil {
+			return fmt.Errorf("ошибка переименования группы: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *GormDB) ListGroups(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	if err := s.db.WithContext(ctx).Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (s *GormDB) AddUserToChat(ctx context.Context, userID int64, chatID int64) error {
+	// Проверяем существование пользователя и чата
+	if err := s.checkUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.checkChat(ctx, chatID); err != nil {
+		return err
+	}
+
+	// Проверяем существование связи
+	linked, err := exists(s.db.WithContext(ctx), &models.UserChat{}, "user_id = ? AND chat_id = ?", userID, chatID)
+	if err != nil {
+		return err
+	}
+	if linked {
+		return fmt.Errorf("пользователь уже существует в этом чате")
+	}
+
+	userChat := models.UserChat{
+		UserID: userID,
+		ChatID: chatID,
+	}
+	return s.db.WithContext(ctx).Create(&userChat).Error
+}
+
+// RemoveUserFromChat удаляет связь пользователя с чатом
+func (s *GormDB) RemoveUserFromChat(ctx context.Context, userID int64, chatID int64) error {
+	return s.db.WithContext(ctx).Where("user_id = ? AND chat_id = ?", userID, chatID).Delete(&models.UserChat{}).Error
+}
+
+// RemoveUsersFromChat удаляет связи нескольких пользователей с чатом
+func (s *GormDB) RemoveUsersFromChat(ctx context.Context, userIDs []int64, chatID int64) error {
+	return s.db.WithContext(ctx).Where("user_id IN ? AND chat_id = ?", userIDs, chatID).Delete(&models.UserChat{}).Error
+}
+
+func (s *GormDB) AddUserToGroup(ctx context.Context, userID int64, groupName string) error {
+	// Проверяем существование пользователя и группы
+	if err := s.checkUser(ctx, userID); err != nil {
+		return err
+	}
+	groupID, err := s.findGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	// Проверяем существование связи
+	linked, err := exists(s.db.WithContext(ctx), &models.UserGroup{}, "user_id = ? AND group_id = ?", userID, groupID)
+	if err != nil || linked {
+		return err // Связь уже существует или ошибка проверки
+	}
+
+	userGroup := models.UserGroup{
+		UserID:  userID,
+		GroupID: groupID,
+	}
+	return s.db.WithContext(ctx).Create(&userGroup).Error
+}
+
+// RemoveUserFromGroup удаляет пользователя из группы
+func (s *GormDB) RemoveUserFromGroup(ctx context.Context, userID int64, groupName string) error {
+	return s.db.WithContext(ctx).Where("user_id = ? AND group_id IN (?)", userID, s.groupIDs(ctx, groupName)).Delete(&models.UserGroup{}).Error
+}
+
+// RemoveUsersFromGroup удаляет нескольких пользователей из группы
+func (s *GormDB) RemoveUsersFromGroup(ctx context.Context, userIDs []int64, groupName string) error {
+	return s.db.WithContext(ctx).Where("user_id IN ? AND group_id IN (?)", userIDs, s.groupIDs(ctx, groupName)).Delete(&models.UserGroup{}).Error
+}
+
+func (s *GormDB) LinkGroupToChat(ctx context.Context, groupName string, chatID int64) error {
+	// Проверяем существование группы и чата
+	groupID, err := s.findGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+	if err := s.checkChat(ctx, chatID); err != nil {
+		return err
+	}
+
+	// Проверяем существование связи
+	linked, err := exists(s.db.WithContext(ctx), &models.GroupChat{}, "group_id = ? AND chat_id = ?", groupID, chatID)
+	if err != nil || linked {
+		return err // Связь уже существует или ошибка проверки
+	}
+
+	groupChat := models.GroupChat{
+		GroupID: groupID,
+		ChatID:  chatID,
+	}
+	return s.db.WithContext(ctx).Create(&groupChat).Error
+}
+
+// UnlinkGroupFromChat отвязывает группу от чата
+func (s *GormDB) UnlinkGroupFromChat(ctx context.Context, groupName string, chatID int64) error {
+	return s.db.WithContext(ctx).Where("group_id IN (?) AND chat_id = ?", s.groupIDs(ctx, groupName), chatID).Delete(&models.GroupChat{}).Error
+}
+
+// GroupLinkedToChat проверяет, привязана ли группа к чату
+func (s *GormDB) GroupLinkedToChat(ctx context.Context, groupName string, chatID int64) (bool, error) {
+	return exists(s.db.WithContext(ctx), &models.GroupChat{}, "group_id IN (?) AND chat_id = ?", s.groupIDs(ctx, groupName), chatID)
+}
+
+// GetUsersForMention возвращает пользователей для упоминания, включая тех, у кого нет username
+func (s *GormDB) GetUsersForMention(ctx context.Context, chatID int64, groupName string) ([]models.User, error) {
+	var users []models.User
+	query := s.db.WithContext(ctx).Joins("JOIN user_chats ON users.user_id = user_chats.user_id").
+		Where("user_chats.chat_id = ?", chatID)
+
+	if groupName != "" {
+		// Группа учитывается только если она привязана к этому чату
+		query = query.Joins("JOIN user_groups ON users.user_id = user_groups.user_id").
+			Joins("JOIN group_chats ON user_groups.group_id = group_chats.group_id AND group_chats.chat_id = user_chats.chat_id").
+			Where("user_groups.group_id IN (?)", s.groupIDs(ctx, groupName))
+	}
+
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return s.filterMuted(ctx, users, chatID, time.Now())
+}
+
+// filterMuted исключает пользователей, отключивших упоминания в чате или глобально
+func (s *GormDB) filterMuted(ctx context.Context, users []models.User, chatID int64, now time.Time) ([]models.User, error) {
+	if len(users) == 0 {
+		return users, nil
+	}
+
+	userIDs := make([]int64, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.UserID)
+	}
+
+	var mutes []models.MentionMute
+	if err := s.db.WithContext(ctx).Where("user_id IN ? AND chat_id IN ?", userIDs, []int64{models.GlobalMuteChatID, chatID}).Find(&mutes).Error; err != nil {
+		return nil, err
+	}
+
+	muted := make(map[int64]bool)
+	for _, mute := range mutes {
+		if mute.ActiveAt(now) {
+			muted[mute.UserID] = true
+		}
+	}
+
+	var result []models.User
+	for _, user := range users {
+		if !muted[user.UserID] {
+			result = append(result, user)
+		}
+	}
+	return result, nil
+}
+
+// MuteMentions отключает упоминания пользователя в чате (или во всех чатах при ChatID = 0)
+func (s *GormDB) MuteMentions(ctx context.Context, mute *models.MentionMute) error {
+	found, err := s.UserExists(ctx, mute.UserID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("пользователь не найден: %d", mute.UserID)
+	}
+	if mute.HasWindow() {
+		if _, err := models.ParseClock(mute.QuietFrom); err != nil {
+			return err
+		}
+		if _, err := models.ParseClock(mute.QuietTo); err != nil {
+			return err
+		}
+	}
+	if mute.Timezone != "" {
+		if _, err := time.LoadLocation(mute.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс: %s", mute.Timezone)
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND chat_id = ?", mute.UserID, mute.ChatID).Delete(&models.MentionMute{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(mute).Error
+	})
+}
+
+// UnmuteMentions снова включает упоминания пользователя в чате (или глобально при chatID = 0)
+func (s *GormDB) UnmuteMentions(ctx context.Context, userID int64, chatID int64) error {
+	return s.db.WithContext(ctx).Where("user_id = ? AND chat_id = ?", userID, chatID).Delete(&models.MentionMute{}).Error
+}
+
+// GetMentionMutes возвращает все отключения упоминаний пользователя
+func (s *GormDB) GetMentionMutes(ctx context.Context, userID int64) ([]models.MentionMute, error) {
+	var mutes []models.MentionMute
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("chat_id").Find(&mutes).Error; err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// GetMentionMutesForChat возвращает отключения упоминаний, действующие в чате:
+// отключения в самом чате и глобальные отключения его участников
+func (s *GormDB) GetMentionMutesForChat(ctx context.Context, chatID int64) ([]models.MentionMute, error) {
+	var mutes []models.MentionMute
+	if err := s.db.WithContext(ctx).Where("chat_id = ?", chatID).
+		Or("chat_id = ? AND user_id IN (?)", models.GlobalMuteChatID,
+			s.db.WithContext(ctx).Model(&models.UserChat{}).Select("user_id").Where("chat_id = ?", chatID)).
+		Order("user_id").
+		Find(&mutes).Error; err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// UserExists проверяет существование пользователя
+func (s *GormDB) UserExists(ctx context.Context, userID int64) (bool, error) {
+	return exists(s.db.WithContext(ctx), &models.User{}, "user_id = ?", userID)
+}
+
+// ChatExists проверяет существование чата
+func (s *GormDB) ChatExists(ctx context.Context, chatID int64) (bool, error) {
+	return exists(s.db.WithContext(ctx), &models.Chat{}, "chat_id = ?", chatID)
+}
+
+// GroupExists проверяет существование группы
+func (s *GormDB) GroupExists(ctx context.Context, name string) (bool, error) {
+	return exists(s.db.WithContext(ctx), &models.Group{}, "name = ?", name)
+}
+
+func (db *GormDB) GetUser(ctx context.Context, userID int64) (*models.User, error) {
+	var user models.User
+	result := db.db.WithContext(ctx).First(&user, "user_id = ?", userID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+func (db *GormDB) GetChat(ctx context.Context, chatID int64) (*models.Chat, error) {
+	var chat models.Chat
+	result := db.db.WithContext(ctx).First(&chat, "chat_id = ?", chatID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &chat, nil
+}
+
+func (db *GormDB) GetGroup(ctx context.Context, name string) (*models.Group, error) {
+	var group models.Group
+	result := db.db.WithContext(ctx).First(&group, "name = ?", name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &group, nil
+}
+
+// GetGroupByID возвращает неудаленную группу по ID; false означает, что группы нет
+func (db *GormDB) GetGroupByID(ctx context.Context, id uint) (*models.Group, bool, error) {
+	var group models.Group
+	err := db.db.WithContext(ctx).First(&group, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &group, true, nil
+}
+
+func (db *GormDB) GetChatsForUser(ctx context.Context, userID int64) ([]models.Chat, error) {
+	var chats []models.Chat
+	if err := db.db.WithContext(ctx).Joins("JOIN user_chats ON chats.chat_id = user_chats.chat_id").
+		Where("user_chats.user_id = ?", userID).
+		Find(&chats).Error; err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
+
+func (db *GormDB) GetGroupsForUser(ctx context.Context, userID int64) ([]models.Group, error) {
+	var groups []models.Group
+	if err := db.db.WithContext(ctx).Joins("JOIN user_groups ON groups.id = user_groups.group_id").
+		Where("user_groups.user_id = ?", userID).
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (db *GormDB) GetGroupsForChat(ctx context.Context, chatID int64) ([]models.Group, error) {
+	var groups []models.Group
+	if err := db.db.WithContext(ctx).Joins("JOIN group_chats ON groups.id = group_chats.group_id").
+		Where("group_chats.chat_id = ?", chatID).
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (db *GormDB) GetChatsForGroup(ctx context.Context, groupName string) ([]models.Chat, error) {
+	group, err := db.preloadGroup(ctx, groupName, "Chats")
+	if group == nil || err != nil {
+		return nil, err
+	}
+	return group.Chats, nil
+}
+
+func (db *GormDB) GetUsersForChat(ctx context.Context, chatID int64) ([]models.User, error) {
+	var chat models.Chat
+	err := db.db.WithContext(ctx).Preload("Users").Where("chat_id = ?", chatID).First(&chat).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return chat.Users, nil
+}
+
+// AddUsersToChat добавляет пользователей в чат в одной транзакции
+func (s *GormDB) AddUsersToChat(ctx context.Context, userIDs []int64, chatID int64) (models.BulkResult, error) {
+	if err := s.checkChat(ctx, chatID); err != nil {
+		return models.BulkResult{}, err
+	}
+	return s.addUsersBulk(ctx, userIDs, &models.UserChat{}, "chat_id = ?", chatID, func(userIDs []int64) interface{} {
+		rows := make([]models.UserChat, 0, len(userIDs))
+		for _, userID := range userIDs {
+			rows = append(rows, models.UserChat{UserID: userID, ChatID: chatID})
+		}
+		return rows
+	})
+}
+
+// AddUsersToGroup добавляет пользователей в группу в одной транзакции
+func (s *GormDB) AddUsersToGroup(ctx context.Context, userIDs []int64, groupName string) (models.BulkResult, error) {
+	groupID, err := s.findGroup(ctx, groupName)
+	if err != nil {
+		return models.BulkResult{}, err
+	}
+	return s.addUsersBulk(ctx, userIDs, &models.UserGroup{}, "group_id = ?", groupID, func(userIDs []int64) interface{} {
+		rows := make([]models.UserGroup, 0, len(userIDs))
+		for _, userID := range userIDs {
+			rows = append(rows, models.UserGroup{UserID: userID, GroupID: groupID})
+		}
+		return rows
+	})
+}
+
+// bulkBatchSize - число строк в одном INSERT при массовом добавлении
+const bulkBatchSize = 500
+
+// addUsersBulk добавляет связи пользователей с чатом или группой в одной транзакции.
+// Неизвестные пользователи пропускаются, уже существующие связи не изменяются (ON CONFLICT DO NOTHING).
+func (s *GormDB) addUsersBulk(ctx context.Context, userIDs []int64, relation interface{}, query string, target interface{}, rows func(userIDs []int64) interface{}) (models.BulkResult, error) {
+	var result models.BulkResult
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		known, unknown, err := splitKnownUsers(tx, userIDs)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки пользователей: %v", err)
+		}
+		result.Unknown = unknown
+		if len(known) == 0 {
+			return nil
+		}
+
+		var present []int64
+		if err := tx.Model(relation).Where(query, target).Where("user_id IN ?", known).Pluck("user_id", &present).Error; err != nil {
+			return fmt.Errorf("ошибка проверки связей: %v", err)
+		}
+		isPresent := make(map[int64]bool, len(present))
+		for _, userID := range present {
+			isPresent[userID] = true
+		}
+		var added []int64
+		for _, userID := range known {
+			if isPresent[userID] {
+				result.Existing = append(result.Existing, userID)
+			} else {
+				added = append(added, userID)
+			}
+		}
+		if len(added) == 0 {
+			return nil
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows(added), bulkBatchSize).Error; err != nil {
+			return fmt.Errorf("ошибка добавления связей: %v", err)
+		}
+		result.Added = added
+		return nil
+	})
+	if err != nil {
+		return models.BulkResult{}, err
+	}
+	return result, nil
+}
+
+// splitKnownUsers разделяет ID на существующих пользователей и неизвестные, убирая повторы
+func splitKnownUsers(tx *gorm.DB, userIDs []int64) (known []int64, unknown []int64, err error) {
+	var found []int64
+	if err := tx.Model(&models.User{}).Where("user_id IN ?", userIDs).Pluck("user_id", &found).Error; err != nil {
+		return nil, nil, err
+	}
+	exists := make(map[int64]bool, len(found))
+	for _, userID := range found {
+		exists[userID] = true
+	}
+
+	seen := make(map[int64]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if exists[userID] {
+			known = append(known, userID)
+		} else {
+			unknown = append(unknown, userID)
+		}
+	}
+	return known, unknown, nil
+}
+
+func (db *GormDB) GetUsersForGroup(ctx context.Context, groupName string) ([]models.User, error) {
+	group, err := db.preloadGroup(ctx, groupName, "Users")
+	if group == nil || err != nil {
+		return nil, err
+	}
+	return group.Users, nil
+}
+
+// preloadGroup загружает группу вместе со связанными записями association (Users или Chats).
+// Для несуществующей группы возвращает nil без ошибки.
+func (db *GormDB) preloadGroup(ctx context.Context, name string, association string) (*models.Group, error) {
+	var group models.Group
+	err := db.db.WithContext(ctx).Preload(association).Where("name = ?", name).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetLastCommandUse возвращает время последнего использования команды в чате пользователем
+// (или в чате вообще при userID = 0)
+func (s *GormDB) GetLastCommandUse(ctx context.Context, command string, chatID int64, userID int64) (time.Time, bool, error) {
+	var usage models.CommandUsage
+	result := s.db.WithContext(ctx).Where("command = ? AND chat_id = ? AND user_id = ?", command, chatID, userID).Limit(1).Find(&usage)
+	if result.Error != nil {
+		return time.Time{}, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return time.Time{}, false, nil
+	}
+	return usage.UsedAt, true, nil
+}
+
+// RecordCommandUse сохраняет время использования команды
+func (s *GormDB) RecordCommandUse(ctx context.Context, command string, chatID int64, userID int64, usedAt time.Time) error {
+	usage := models.CommandUsage{
+		Command: command,
+		ChatID:  chatID,
+		UserID:  userID,
+		UsedAt:  usedAt,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "command"}, {Name: "chat_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"used_at"}),
+	}).Create(&usage).Error
+}
+
+// GrantRole выдает пользователю роль (глобально при chatID = 0 или в конкретном чате)
+func (s *GormDB) GrantRole(ctx context.Context, userID int64, role string, chatID int64) error {
+	if chatID != 0 {
+		found, err := s.ChatExists(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("чат не найден: %d", chatID)
+		}
+	}
+
+	userRole := models.UserRole{
+		UserID: userID,
+		Role:   role,
+		ChatID: chatID,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&userRole).Error
+}
+
+// RevokeRole отзывает роль пользователя
+func (s *GormDB) RevokeRole(ctx context.Context, userID int64, role string, chatID int64) error {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND role = ? AND chat_id = ?", userID, role, chatID).Delete(&models.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("у пользователя %d нет роли %s", userID, role)
+	}
+	return nil
+}
+
+// GetUserRoles возвращает роли пользователя
+func (s *GormDB) GetUserRoles(ctx context.Context, userID int64) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("chat_id, role").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// ListRoles возвращает все выданные роли
+func (s *GormDB) ListRoles(ctx context.Context) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	if err := s.db.WithContext(ctx).Order("user_id, chat_id, role").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetConversation возвращает активный диалог пользователя
+func (s *GormDB) GetConversation(ctx context.Context, userID int64) (*models.Conversation, bool, error) {
+	var conversation models.Conversation
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &conversation, true, nil
+}
+
+// SaveConversation создает или обновляет диалог пользователя
+func (s *GormDB) SaveConversation(ctx context.Context, conversation *models.Conversation) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"chat_id", "flow", "step", "data", "expires_at", "updated_at"}),
+	}).Create(conversation).Error
+}
+
+// DeleteConversation завершает диалог пользователя
+func (s *GormDB) DeleteConversation(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Conversation{}).Error
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"sort"
+	"testing"
+	"weveryone_bot_v2/models"
+)
+
+// must останавливает тест при ошибке подготовки данных
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("ошибка подготовки данных: %v", err)
+	}
+}
+
+// userIDs возвращает отсортированные идентификаторы пользователей
+func userIDs(users []models.User) []int64 {
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.UserID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// chatIDs возвращает отсортированные идентификаторы чатов
+func chatIDs(chats []models.Chat) []int64 {
+	ids := make([]int64, 0, len(chats))
+	for _, chat := range chats {
+		ids = append(ids, chat.ChatID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mustBool возвращает функцию, которая разворачивает результат проверки (bool, error)
+// и останавливает тест при ошибке
+func mustBool(t *testing.T) func(bool, error) bool {
+	return func(ok bool, err error) bool {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("ошибка проверки: %v", err)
+		}
+		return ok
+	}
+}
+
+// backends - базы, на которых проверяются миграции: SQLite всегда,
+// PostgreSQL - если задан TEST_DATABASE_URL
+var backends = []struct {
+	name string
+	open func(t *testing.T) *GormDB
+}{
+	{"sqlite", openSQLite},
+	{"postgres", openPostgres},
+}
+
+// forEachBackend запускает test на пустой базе без миграций каждого бэкенда
+func forEachBackend(t *testing.T, test func(t *testing.T, db *GormDB)) {
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.open(t))
+		})
+	}
+}
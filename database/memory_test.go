@@ -0,0 +1,13 @@
+package database
+
+import (
+	"testing"
+	"weveryone_bot_v2/database/dbtest"
+	"weveryone_bot_v2/interfaces"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) interfaces.Database {
+		return dbtest.NewMemoryDB()
+	})
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration - шаг изменения схемы или данных. Каждый шаг выполняется в отдельной транзакции
+// вместе с записью в schema_migrations, поэтому прерванная миграция не применяется частично.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down откатывает Up. Если не задан, откат миграции невозможен.
+	Down func(tx *gorm.DB) error
+}
+
+// schemaMigration - запись о примененной миграции
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus описывает состояние одной миграции
+type MigrationStatus struct {
+	Version int
+	Name    string
+	// Applied - время применения, нулевое для непримененных миграций
+	Applied time.Time
+	// Unknown - миграция применена более новой версией бота и неизвестна этой
+	Unknown bool
+}
+
+// appliedMigrations возвращает примененные миграции по номерам, создавая таблицу при необходимости
+func (s *GormDB) appliedMigrations(ctx context.Context) (map[int]schemaMigration, error) {
+	db := s.db.WithContext(ctx)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		if err := db.Migrator().CreateTable(&schemaMigration{}); err != nil {
+			return nil, fmt.Errorf("ошибка создания таблицы миграций: %v", err)
+		}
+	}
+
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка чтения таблицы миграций: %v", err)
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// checkUnknown проверяет, что среди примененных нет миграций, неизвестных этой версии бота
+func checkUnknown(applied map[int]schemaMigration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for version, row := range applied {
+		if !known[version] {
+			return fmt.Errorf("миграция %d (%s) применена более новой версией бота", version, row.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp применяет все непримененные миграции по порядку.
+// Если база уже обновлена более новой версией бота, возвращает ошибку.
+func (s *GormDB) MigrateUp(ctx context.Context) error {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkUnknown(applied); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка применения миграции %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown откатывает последнюю примененную миграцию и возвращает ее описание
+func (s *GormDB) MigrateDown(ctx context.Context) (MigrationStatus, error) {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	if err := checkUnknown(applied); err != nil {
+		return MigrationStatus{}, err
+	}
+
+	var last *migration
+	for i := range migrations {
+		if _, ok := applied[migrations[i].Version]; ok {
+			last = &migrations[i]
+		}
+	}
+	if last == nil {
+		return MigrationStatus{}, fmt.Errorf("нет примененных миграций")
+	}
+	if last.Down == nil {
+		return MigrationStatus{}, fmt.Errorf("миграция %d (%s) не поддерживает откат", last.Version, last.Name)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := last.Down(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&schemaMigration{}, last.Version).Error
+	})
+	if err != nil {
+		return MigrationStatus{}, fmt.Errorf("ошибка отката миграции %d (%s): %v", last.Version, last.Name, err)
+	}
+	return MigrationStatus{Version: last.Version, Name: last.Name}, nil
+}
+
+// Migrations возвращает состояние всех известных и примененных миграций по номерам
+func (s *GormDB) Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			status.Applied = row.AppliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, Applied: row.AppliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
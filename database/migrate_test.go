@@ -0,0 +1,227 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+	"weveryone_bot_v2/models"
+)
+
+// appliedVersions возвращает номера примененных миграций
+func appliedVersions(t *testing.T, db *GormDB) []int {
+	t.Helper()
+	statuses, err := db.Migrations(context.Background())
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	var versions []int
+	for _, status := range statuses {
+		if !status.Applied.IsZero() {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *GormDB) {
+		ctx := context.Background()
+
+		if versions := appliedVersions(t, db); len(versions) != 0 {
+			t.Fatalf("в новой базе применены миграции %v", versions)
+		}
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		if versions := appliedVersions(t, db); len(versions) != len(migrations) {
+			t.Fatalf("применены миграции %v, ожидалось %d", versions, len(migrations))
+		}
+		// Повторный запуск ничего не делает
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("повторный MigrateUp: %v", err)
+		}
+
+		last := migrations[len(migrations)-1]
+		rolledBack, err := db.MigrateDown(ctx)
+		if err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if rolledBack.Version != last.Version {
+			t.Errorf("откачена миграция %d, ожидалась %d", rolledBack.Version, last.Version)
+		}
+		if versions := appliedVersions(t, db); len(versions) != len(migrations)-1 {
+			t.Errorf("после отката применены миграции %v", versions)
+		}
+
+		// Откатываются все миграции, кроме начальной схемы
+		for range migrations[1 : len(migrations)-1] {
+			if _, err := db.MigrateDown(ctx); err != nil {
+				t.Fatalf("MigrateDown: %v", err)
+			}
+		}
+		if _, err := db.MigrateDown(ctx); err == nil {
+			t.Error("MigrateDown откатил начальную схему")
+		}
+		if versions := appliedVersions(t, db); len(versions) != 1 || versions[0] != 1 {
+			t.Errorf("после отката применены миграции %v, ожидалась только 1", versions)
+		}
+		if !db.db.Migrator().HasTable(&userV1{}) {
+			t.Error("таблица users удалена")
+		}
+
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp после отката: %v", err)
+		}
+	})
+}
+
+// TestMigrateLegacyDatabase проверяет обновление базы, созданной AutoMigrate до появления миграций
+func TestMigrateLegacyDatabase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *GormDB) {
+		ctx := context.Background()
+
+		if err := db.db.AutoMigrate(schemaV1...); err != nil {
+			t.Fatalf("ошибка создания старой схемы: %v", err)
+		}
+		rows := []interface{}{
+			&userV1{UserID: 1},
+			&chatV1{ChatID: -100},
+			&groupV1{Name: "dev"},
+			&userChatV1{UserID: 1, ChatID: -100},
+			&userGroupV1{UserID: 1, GroupName: "dev"},
+			&groupChatV1{GroupName: "dev", ChatID: -100},
+			// Связи с несуществующими пользователями, чатами и группами
+			&userChatV1{UserID: 2, ChatID: -100},
+			&userGroupV1{UserID: 1, GroupName: "old"},
+			&groupChatV1{GroupName: "dev", ChatID: -200},
+		}
+		for _, row := range rows {
+			if err := db.db.Create(row).Error; err != nil {
+				t.Fatalf("ошибка подготовки данных: %v", err)
+			}
+		}
+
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+
+		for _, model := range []interface{}{&userChatV1{}, &userGroupV1{}, &groupChatV1{}} {
+			var count int64
+			db.db.Model(model).Count(&count)
+			if count != 1 {
+				t.Errorf("в %T осталось %d связей, ожидалась 1", model, count)
+			}
+		}
+
+		// Откат до начальной схемы не удаляет данные, созданные до появления миграций
+		for range migrations[1:] {
+			if _, err := db.MigrateDown(ctx); err != nil {
+				t.Fatalf("MigrateDown: %v", err)
+			}
+		}
+		if _, err := db.MigrateDown(ctx); err == nil {
+			t.Error("MigrateDown откатил начальную схему")
+		}
+		for _, model := range []interface{}{&userV1{}, &chatV1{}, &groupV1{}, &userChatV1{}} {
+			var count int64
+			if err := db.db.Model(model).Count(&count).Error; err != nil || count != 1 {
+				t.Errorf("в %T после отката %d записей (%v), ожидалась 1", model, count, err)
+			}
+		}
+	})
+}
+
+func TestMigrateRejectsUnknownVersion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *GormDB) {
+		ctx := context.Background()
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+
+		// Миграция, примененная более новой версией бота
+		future := schemaMigration{Version: migrations[len(migrations)-1].Version + 1, Name: "future", AppliedAt: time.Now()}
+		if err := db.db.Create(&future).Error; err != nil {
+			t.Fatalf("ошибка подготовки данных: %v", err)
+		}
+
+		if err := db.MigrateUp(ctx); err == nil {
+			t.Error("MigrateUp не вернул ошибку для неизвестной миграции")
+		}
+		if _, err := db.MigrateDown(ctx); err == nil {
+			t.Error("MigrateDown не вернул ошибку для неизвестной миграции")
+		}
+		statuses, err := db.Migrations(ctx)
+		if err != nil {
+			t.Fatalf("Migrations: %v", err)
+		}
+		if last := statuses[len(statuses)-1]; !last.Unknown || last.Version != future.Version {
+			t.Errorf("неизвестная миграция не отмечена: %+v", last)
+		}
+	})
+}
+
+// TestMigrateGroupRelationsByID проверяет перенос связей групп с названия на ID и обратно
+func TestMigrateGroupRelationsByID(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *GormDB) {
+		ctx := context.Background()
+		migrated(t, db)
+
+		// Возвращаем схему, в которой связи ссылаются на название группы
+		for db.db.Migrator().HasColumn(&userGroupV3{}, "group_id") {
+			if _, err := db.MigrateDown(ctx); err != nil {
+				t.Fatalf("MigrateDown: %v", err)
+			}
+		}
+		rows := []interface{}{
+			&userV1{UserID: 1},
+			&chatV1{ChatID: -100},
+			&groupV1{Name: "other"},
+			&groupV1{Name: "dev"},
+			&userChatV1{UserID: 1, ChatID: -100},
+			&userGroupV1{UserID: 1, GroupName: "dev"},
+			&groupChatV1{GroupName: "dev", ChatID: -100},
+		}
+		for _, row := range rows {
+			if err := db.db.Create(row).Error; err != nil {
+				t.Fatalf("ошибка подготовки данных: %v", err)
+			}
+		}
+
+		if err := db.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		must(t, db.RenameGroup(ctx, "dev", "backend"))
+
+		var group models.Group
+		if err := db.db.Preload("Users").Preload("Chats").Where("name = ?", "backend").First(&group).Error; err != nil {
+			t.Fatalf("ошибка загрузки группы: %v", err)
+		}
+		if ids := userIDs(group.Users); !equalIDs(ids, []int64{1}) {
+			t.Errorf("участники группы после миграции: %v", ids)
+		}
+		if ids := chatIDs(group.Chats); !equalIDs(ids, []int64{-100}) {
+			t.Errorf("чаты группы после миграции: %v", ids)
+		}
+		var chat models.Chat
+		if err := db.db.Preload("Users").Where("chat_id = ?", -100).First(&chat).Error; err != nil {
+			t.Fatalf("ошибка загрузки чата: %v", err)
+		}
+		if ids := userIDs(chat.Users); !equalIDs(ids, []int64{1}) {
+			t.Errorf("участники чата: %v", ids)
+		}
+
+		// Откат возвращает связям название группы
+		for db.db.Migrator().HasColumn(&userGroupV3{}, "group_id") {
+			if _, err := db.MigrateDown(ctx); err != nil {
+				t.Fatalf("MigrateDown: %v", err)
+			}
+		}
+		for _, model := range []interface{}{&userGroupV1{}, &groupChatV1{}} {
+			var count int64
+			db.db.Model(model).Where("group_name = ?", "backend").Count(&count)
+			if count != 1 {
+				t.Errorf("в %T после отката %d связей с группой backend, ожидалась 1", model, count)
+			}
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations - все миграции по возрастанию номера. Примененные миграции нельзя менять:
+// новые изменения схемы и данных добавляются следующим номером.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			// В базах, созданных до появления миграций, таблицы уже есть и AutoMigrate
+			// только добавит недостающие столбцы и индексы
+			return tx.Migrator().AutoMigrate(schemaV1...)
+		},
+		// Отката нет: в базах, созданных до появления миграций, он удалил бы все данные
+	},
+	{
+		Version: 2,
+		Name:    "remove_orphan_relations",
+		Up:      removeOrphansV1,
+		// Удаленные связи ссылались на несуществующие записи, восстанавливать нечего
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 3,
+		Name:    "group_relations_by_id",
+		Up: func(tx *gorm.DB) error {
+			if err := rebuildTable(tx, "user_groups", &userGroupV3{}, "user_id, group_id, created_at",
+				"SELECT user_groups.user_id, g.id AS group_id, user_groups.created_at "+
+					"FROM user_groups JOIN %s g ON g.name = user_groups.group_name"); err != nil {
+				return err
+			}
+			return rebuildTable(tx, "group_chats", &groupChatV3{}, "group_id, chat_id, created_at",
+				"SELECT g.id AS group_id, group_chats.chat_id, group_chats.created_at "+
+					"FROM group_chats JOIN %s g ON g.name = group_chats.group_name")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := rebuildTable(tx, "user_groups", &userGroupV1{}, "user_id, group_name, created_at",
+				"SELECT user_groups.user_id, g.name AS group_name, user_groups.created_at "+
+					"FROM user_groups JOIN %s g ON g.id = user_groups.group_id"); err != nil {
+				return err
+			}
+			return rebuildTable(tx, "group_chats", &groupChatV1{}, "group_name, chat_id, created_at",
+				"SELECT g.name AS group_name, group_chats.chat_id, group_chats.created_at "+
+					"FROM group_chats JOIN %s g ON g.id = group_chats.group_id")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "drop_unused_join_tables",
+		// Таблицы many2many, которые AutoMigrate создавал для неиспользуемых связей моделей
+		Up: func(tx *gorm.DB) error {
+			for _, table := range []string{"chat_users", "group_users", "chat_groups"} {
+				if err := tx.Exec("DROP TABLE IF EXISTS " + tx.Statement.Quote(table)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// Таблицы всегда были пустыми, восстанавливать нечего
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 5,
+		Name:    "username_locked",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&userV5{}, "UsernameLocked") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&userV5{}, "UsernameLocked")
+		},
+		// Предыдущие версии не читают столбец, а удаление столбца в SQLite требует
+		// пересоздания таблицы users, поэтому столбец остается до повторного Up
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// rebuildTable пересоздает таблицу по схеме model. Запрос query сохраняет данные во временную
+// таблицу, после чего старая таблица удаляется, новая создается под тем же именем и получает
+// столбцы columns. SQLite не умеет менять первичный ключ существующей таблицы, а переименование
+// заранее созданной таблицы оставило бы в PostgreSQL имена ограничений от временного имени.
+// В query %s заменяется таблицей групп; имена экранируются, так как groups -
+// зарезервированное слово в MySQL 8.
+func rebuildTable(tx *gorm.DB, table string, model interface{}, columns string, query string) error {
+	quote := tx.Statement.Quote
+	tmp := quote(table + "_copy")
+	if err := tx.Exec("CREATE TEMPORARY TABLE " + tmp + " AS " + fmt.Sprintf(query, quote("groups"))).Error; err != nil {
+		return fmt.Errorf("ошибка копирования данных %s: %v", table, err)
+	}
+	if err := tx.Exec("DROP TABLE " + quote(table)).Error; err != nil {
+		return fmt.Errorf("ошибка удаления таблицы %s: %v", table, err)
+	}
+	if err := tx.Migrator().CreateTable(model); err != nil {
+		return fmt.Errorf("ошибка создания таблицы %s: %v", table, err)
+	}
+	if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quote(table), columns, columns, tmp)).Error; err != nil {
+		return fmt.Errorf("ошибка переноса данных в %s: %v", table, err)
+	}
+	return tx.Exec("DROP TABLE " + tmp).Error
+}
+
+// Схема версии 1 - таблицы в том виде, в каком их создавал AutoMigrate до появления миграций.
+// Миграции используют собственные копии моделей, чтобы изменения в models не меняли
+// уже примененные шаги.
+type (
+	userV1 struct {
+		gorm.Model
+		UserID       int64 `gorm:"uniqueIndex"`
+		Username     string
+		FirstName    string
+		LastName     string
+		LanguageCode string
+	}
+	chatV1 struct {
+		gorm.Model
+		ChatID int64 `gorm:"uniqueIndex"`
+		Title  string
+		Active bool `gorm:"default:true"`
+	}
+	groupV1 struct {
+		gorm.Model
+		Name string `gorm:"uniqueIndex"`
+	}
+	userChatV1 struct {
+		UserID    int64     `gorm:"primaryKey"`
+		ChatID    int64     `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	userGroupV1 struct {
+		UserID    int64     `gorm:"primaryKey"`
+		GroupName string    `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	groupChatV1 struct {
+		GroupName string    `gorm:"primaryKey"`
+		ChatID    int64     `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	usernameHistoryV1 struct {
+		ID        uint  `gorm:"primaryKey"`
+		UserID    int64 `gorm:"index"`
+		Username  string
+		ChangedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	mentionMuteV1 struct {
+		UserID    int64 `gorm:"primaryKey"`
+		ChatID    int64 `gorm:"primaryKey"`
+		QuietFrom string
+		QuietTo   string
+		Timezone  string
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	commandUsageV1 struct {
+		Command string `gorm:"primaryKey"`
+		ChatID  int64  `gorm:"primaryKey"`
+		UserID  int64  `gorm:"primaryKey"`
+		UsedAt  time.Time
+	}
+	userRoleV1 struct {
+		UserID    int64     `gorm:"primaryKey"`
+		Role      string    `gorm:"primaryKey"`
+		ChatID    int64     `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	conversationV1 struct {
+		UserID    int64 `gorm:"primaryKey"`
+		ChatID    int64
+		Flow      string
+		Step      int
+		Data      string
+		ExpiresAt time.Time `gorm:"index"`
+		UpdatedAt time.Time
+	}
+)
+
+func (userV1) TableName() string            { return "users" }
+func (chatV1) TableName() string            { return "chats" }
+func (groupV1) TableName() string           { return "groups" }
+func (userChatV1) TableName() string        { return "user_chats" }
+func (userGroupV1) TableName() string       { return "user_groups" }
+func (groupChatV1) TableName() string       { return "group_chats" }
+func (usernameHistoryV1) TableName() string { return "username_histories" }
+func (mentionMuteV1) TableName() string     { return "mention_mutes" }
+func (commandUsageV1) TableName() string    { return "command_usages" }
+func (userRoleV1) TableName() string        { return "user_roles" }
+func (conversationV1) TableName() string    { return "conversations" }
+
+var schemaV1 = []interface{}{
+	&userV1{},
+	&chatV1{},
+	&groupV1{},
+	&userChatV1{},
+	&userGroupV1{},
+	&groupChatV1{},
+	&usernameHistoryV1{},
+	&mentionMuteV1{},
+	&commandUsageV1{},
+	&userRoleV1{},
+	&conversationV1{},
+}
+
+// Схема версии 3 - участники групп и привязки к чатам ссылаются на ID группы
+type (
+	userGroupV3 struct {
+		UserID    int64     `gorm:"primaryKey"`
+		GroupID   uint      `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+	groupChatV3 struct {
+		GroupID   uint      `gorm:"primaryKey"`
+		ChatID    int64     `gorm:"primaryKey"`
+		CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	}
+)
+
+func (userGroupV3) TableName() string { return "user_groups" }
+func (groupChatV3) TableName() string { return "group_chats" }
+
+// userV5 - пользователь с признаком username, заданного администратором
+type userV5 struct {
+	userV1
+	UsernameLocked bool `gorm:"default:false"`
+}
+
+// removeOrphansV1 удаляет связи с удаленными и несуществующими пользователями, чатами и группами,
+// оставшиеся с тех пор, когда удаление сущностей не затрагивало связи
+func removeOrphansV1(tx *gorm.DB) error {
+	users := tx.Model(&userV1{}).Select("user_id")
+	chats := tx.Model(&chatV1{}).Select("chat_id")
+	groups := tx.Model(&groupV1{}).Select("name")
+	if err := tx.Where("user_id NOT IN (?)", users).Or("chat_id NOT IN (?)", chats).Delete(&userChatV1{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id NOT IN (?)", users).Or("group_name NOT IN (?)", groups).Delete(&userGroupV1{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("group_name NOT IN (?)", groups).Or("chat_id NOT IN (?)", chats).Delete(&groupChatV1{}).Error
+}
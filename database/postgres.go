@@ -0,0 +1,11 @@
+package database
+
+import (
+	"gorm.io/driver/postgres"
+)
+
+// NewPostgresDB подключается к PostgreSQL по строке подключения dsn
+// (URL postgres://... или формат key=value)
+func NewPostgresDB(dsn string) (*GormDB, error) {
+	return open(postgres.Open(dsn))
+}
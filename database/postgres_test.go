@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"weveryone_bot_v2/interfaces"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// schemaCounter делает имена тестовых схем уникальными в пределах запуска
+var schemaCounter int64
+
+// TestPostgresConformance запускается, только если задан TEST_DATABASE_URL.
+// С REQUIRE_POSTGRES=1 (так запускает CI) тест без базы падает, а не пропускается.
+func TestPostgresConformance(t *testing.T) {
+	postgresDSN(t)
+	runConformance(t, func(t *testing.T) interfaces.Database {
+		return migrated(t, openPostgres(t))
+	})
+}
+
+// postgresDSN возвращает TEST_DATABASE_URL или пропускает тест, если он не задан
+func postgresDSN(t *testing.T) string {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		if os.Getenv("REQUIRE_POSTGRES") != "" {
+			t.Fatal("TEST_DATABASE_URL не задан, а REQUIRE_POSTGRES требует тестов на PostgreSQL")
+		}
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	return dsn
+}
+
+// openPostgres открывает пустую базу PostgreSQL без миграций. Каждый тест работает
+// в отдельной схеме, которая удаляется после теста.
+func openPostgres(t *testing.T) *GormDB {
+	dsn := postgresDSN(t)
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("ошибка подключения к PostgreSQL: %v", err)
+	}
+	schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&schemaCounter, 1))
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("ошибка создания схемы: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	db, err := NewPostgresDB(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatalf("ошибка открытия базы: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// withSearchPath добавляет в строку подключения схему по умолчанию
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
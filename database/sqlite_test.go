@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	"weveryone_bot_v2/interfaces"
+	"weveryone_bot_v2/models"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	runConformance(t, func(t *testing.T) interfaces.Database {
+		return migrated(t, openSQLite(t))
+	})
+}
+
+// openSQLite открывает пустую базу SQLite во временном каталоге без миграций
+func openSQLite(t *testing.T) *GormDB {
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("ошибка открытия базы: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// closeOnCleanup закрывает соединения с базой после теста
+func closeOnCleanup(t *testing.T, db *GormDB) {
+	t.Cleanup(func() {
+		if sqlDB, err := db.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// migrated применяет к базе все миграции
+func migrated(t *testing.T, db *GormDB) *GormDB {
+	if err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("ошибка миграции: %v", err)
+	}
+	return db
+}
+
+// TestUpsertUserSingleConnection проверяет, что UpsertUser выполняет все запросы в своей транзакции:
+// запрос мимо транзакции ждал бы освобождения единственного соединения до истечения контекста
+func TestUpsertUserSingleConnection(t *testing.T) {
+	has := mustBool(t)
+	db := migrated(t, openSQLite(t))
+	sqlDB, err := db.db.DB()
+	if err != nil {
+		t.Fatalf("ошибка получения соединения: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	must(t, db.AddUser(ctx, 1, "old", "", ""))
+	must(t, db.DeleteUser(ctx, 1))
+	if err := db.UpsertUser(ctx, &models.User{UserID: 1, Username: "new"}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if has(db.UserExists(ctx, 1)) {
+		t.Error("UpsertUser восстановил удаленного пользователя")
+	}
+}
+
+// TestQueryErrorsReturned проверяет, что ошибки базы не превращаются в ответ "не найдено"
+func TestQueryErrorsReturned(t *testing.T) {
+	db := migrated(t, openSQLite(t))
+	sqlDB, err := db.db.DB()
+	if err != nil {
+		t.Fatalf("ошибка получения соединения: %v", err)
+	}
+	sqlDB.Close()
+
+	ctx := context.Background()
+	if _, err := db.UserExists(ctx, 1); err == nil {
+		t.Error("UserExists не вернул ошибку")
+	}
+	if _, err := db.GroupLinkedToChat(ctx, "dev", -100); err == nil {
+		t.Error("GroupLinkedToChat не вернул ошибку")
+	}
+	if _, _, err := db.GetLastCommandUse(ctx, "all", -100, 1); err == nil {
+		t.Error("GetLastCommandUse не вернул ошибку")
+	}
+	if _, _, err := db.GetConversation(ctx, 1); err == nil {
+		t.Error("GetConversation не вернул ошибку")
+	}
+	if err := db.AddUserToChat(ctx, 1, -100); err == nil || err.Error() == "пользователь не найден: 1" {
+		t.Errorf("AddUserToChat скрыл ошибку базы: %v", err)
+	}
+}
@@ -1,13 +1,18 @@
 package interfaces
 
-import "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"context"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
 
 type Bot interface {
 	// Основные команды
-	HandleCommand(update tgbotapi.Update)
-	HandleCallbackQuery(update tgbotapi.Update)
+	HandleCommand(ctx context.Context, update tgbotapi.Update)
+	HandleCallbackQuery(ctx context.Context, update tgbotapi.Update)
+	HandleMessage(ctx context.Context, update tgbotapi.Update)
 
 	// Админ-панель
-	ShowAdminPanel(chatID int64)
-	IsAdmin(userID int64) bool
-} 
\ No newline at end of file
+	ShowAdminPanel(chatID int64, update *tgbotapi.Update)
+	IsAdmin(ctx context.Context, userID int64, chatID int64) bool
+}
@@ -1,41 +1,95 @@
 package interfaces
 
-import "weveryone_bot_v2/models"
+import (
+	"context"
+	"errors"
+	"time"
+	"weveryone_bot_v2/models"
+)
 
-// Database определяет интерфейс для работы с базой данных
+// ErrDeleted возвращается при попытке добавить удаленную сущность или связь с ней
+var ErrDeleted = errors.New("запись удалена, ее можно восстановить")
+
+// Database определяет интерфейс для работы с базой данных.
+// Все методы принимают контекст, который ограничивает время выполнения запросов.
 type Database interface {
 	// Методы для работы с пользователями
-	AddUser(userID int64, username string) error
-	DeleteUser(userID int64) error
-	ListUsers() []models.User
-	UserExists(userID int64) bool
-	GetUser(userID int64) (*models.User, error)
-	GetChatsForUser(userID int64) []models.Chat
-	GetGroupsForUser(userID int64) []models.Group
+	AddUser(ctx context.Context, userID int64, username, firstName, lastName string) error
+	UpsertUser(ctx context.Context, user *models.User) error
+	SetUsername(ctx context.Context, userID int64, username string) error
+	GetUsernameHistory(ctx context.Context, userID int64) ([]models.UsernameHistory, error)
+	DeleteUser(ctx context.Context, userID int64) error
+	ListUsers(ctx context.Context) ([]models.User, error)
+	UserExists(ctx context.Context, userID int64) (bool, error)
+	GetUser(ctx context.Context, userID int64) (*models.User, error)
+	GetChatsForUser(ctx context.Context, userID int64) ([]models.Chat, error)
+	GetGroupsForUser(ctx context.Context, userID int64) ([]models.Group, error)
 
 	// Методы для работы с чатами
-	AddChat(chatID int64, title string) error
-	DeleteChat(chatID int64) error
-	ListChats() []models.Chat
-	ChatExists(chatID int64) bool
-	GetChat(chatID int64) (*models.Chat, error)
-	GetUsersForMention(chatID int64, groupName string) []string
-	GetGroupsForChat(chatID int64) []models.Group
+	AddChat(ctx context.Context, chatID int64, title string) error
+	DeleteChat(ctx context.Context, chatID int64) error
+	SetChatActive(ctx context.Context, chatID int64, active bool) error
+	SetChatTitle(ctx context.Context, chatID int64, title string) error
+	ListChats(ctx context.Context) ([]models.Chat, error)
+	ChatExists(ctx context.Context, chatID int64) (bool, error)
+	GetChat(ctx context.Context, chatID int64) (*models.Chat, error)
+	GetUsersForMention(ctx context.Context, chatID int64, groupName string) ([]models.User, error)
+	GetGroupsForChat(ctx context.Context, chatID int64) ([]models.Group, error)
 
 	// Методы для работы с группами
-	AddGroup(name string) error
-	DeleteGroup(name string) error
-	ListGroups() []models.Group
-	GroupExists(name string) bool
-	GetGroup(name string) (*models.Group, error)
-	GetChatsForGroup(groupName string) []models.Chat
-	GetUsersForGroup(groupName string) []models.User
+	AddGroup(ctx context.Context, name string) error
+	DeleteGroup(ctx context.Context, name string) error
+	RenameGroup(ctx context.Context, oldName, newName string) error
+	ListGroups(ctx context.Context) ([]models.Group, error)
+	GroupExists(ctx context.Context, name string) (bool, error)
+	GetGroup(ctx context.Context, name string) (*models.Group, error)
+	GetGroupByID(ctx context.Context, id uint) (*models.Group, bool, error)
+	GetChatsForGroup(ctx context.Context, groupName string) ([]models.Chat, error)
+	GetUsersForGroup(ctx context.Context, groupName string) ([]models.User, error)
 
 	// Методы для работы со связями
-	AddUserToChat(userID int64, chatID int64) error
-	AddUserToGroup(userID int64, groupName string) error
-	LinkGroupToChat(groupName string, chatID int64) error
-	GetUsersForChat(chatID int64) []models.User
-	AddUsersToChat(userIDs []int64, chatID int64) error
-	AddUsersToGroup(userIDs []int64, groupName string) error
-} 
\ No newline at end of file
+	AddUserToChat(ctx context.Context, userID int64, chatID int64) error
+	RemoveUserFromChat(ctx context.Context, userID int64, chatID int64) error
+	RemoveUsersFromChat(ctx context.Context, userIDs []int64, chatID int64) error
+	AddUserToGroup(ctx context.Context, userID int64, groupName string) error
+	RemoveUserFromGroup(ctx context.Context, userID int64, groupName string) error
+	RemoveUsersFromGroup(ctx context.Context, userIDs []int64, groupName string) error
+	LinkGroupToChat(ctx context.Context, groupName string, chatID int64) error
+	UnlinkGroupFromChat(ctx context.Context, groupName string, chatID int64) error
+	GroupLinkedToChat(ctx context.Context, groupName string, chatID int64) (bool, error)
+	GetUsersForChat(ctx context.Context, chatID int64) ([]models.User, error)
+	AddUsersToChat(ctx context.Context, userIDs []int64, chatID int64) (models.BulkResult, error)
+	AddUsersToGroup(ctx context.Context, userIDs []int64, groupName string) (models.BulkResult, error)
+
+	// Методы для восстановления и окончательного удаления
+	ListDeletedUsers(ctx context.Context) ([]models.User, error)
+	ListDeletedChats(ctx context.Context) ([]models.Chat, error)
+	ListDeletedGroups(ctx context.Context) ([]models.Group, error)
+	RestoreUser(ctx context.Context, userID int64) error
+	RestoreChat(ctx context.Context, chatID int64) error
+	RestoreGroup(ctx context.Context, name string) error
+	PurgeUser(ctx context.Context, userID int64) error
+	PurgeChat(ctx context.Context, chatID int64) error
+	PurgeGroup(ctx context.Context, name string) error
+
+	// Методы для отключения упоминаний
+	MuteMentions(ctx context.Context, mute *models.MentionMute) error
+	UnmuteMentions(ctx context.Context, userID int64, chatID int64) error
+	GetMentionMutes(ctx context.Context, userID int64) ([]models.MentionMute, error)
+	GetMentionMutesForChat(ctx context.Context, chatID int64) ([]models.MentionMute, error)
+
+	// Методы для ограничения частоты команд
+	GetLastCommandUse(ctx context.Context, command string, chatID int64, userID int64) (time.Time, bool, error)
+	RecordCommandUse(ctx context.Context, command string, chatID int64, userID int64, usedAt time.Time) error
+
+	// Методы для работы с ролями
+	GrantRole(ctx context.Context, userID int64, role string, chatID int64) error
+	RevokeRole(ctx context.Context, userID int64, role string, chatID int64) error
+	GetUserRoles(ctx context.Context, userID int64) ([]models.UserRole, error)
+	ListRoles(ctx context.Context) ([]models.UserRole, error)
+
+	// Методы для пошагового ввода данных
+	GetConversation(ctx context.Context, userID int64) (*models.Conversation, bool, error)
+	SaveConversation(ctx context.Context, conversation *models.Conversation) error
+	DeleteConversation(ctx context.Context, userID int64) error
+}
@@ -1,36 +1,95 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 	"weveryone_bot_v2/bot"
 	"weveryone_bot_v2/database"
 	"weveryone_bot_v2/interfaces"
+	"weveryone_bot_v2/models"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// getEnv возвращает значение переменной окружения без пробелов по краям
+// или defaultValue, если переменная не задана
 func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
+	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
 		return defaultValue
 	}
 	return value
 }
 
-// saveUser сохраняет информацию о пользователе
-func saveUser(db interfaces.Database, user *tgbotapi.User) error {
+// openDatabase подключается к PostgreSQL, если задан DATABASE_URL, иначе открывает файл SQLite.
+// С PostgreSQL можно запускать несколько экземпляров бота с общей базой.
+func openDatabase() (*database.GormDB, error) {
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return database.NewPostgresDB(url)
+	}
+	return database.NewSQLiteDB("data/bot.db")
+}
+
+// runMigrate выполняет команду флага -migrate
+func runMigrate(ctx context.Context, db *database.GormDB, command string) error {
+	switch command {
+	case "up":
+		if err := db.MigrateUp(ctx); err != nil {
+			return err
+		}
+		fmt.Println("Все миграции применены")
+	case "down":
+		status, err := db.MigrateDown(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Откачена миграция %d (%s)\n", status.Version, status.Name)
+	case "status":
+		statuses, err := db.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "не применена"
+			if !status.Applied.IsZero() {
+				state = "применена " + status.Applied.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state += ", неизвестна этой версии бота"
+			}
+			fmt.Printf("%4d %-30s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("неизвестная команда -migrate: %s (ожидается up, down или status)", command)
+	}
+	return nil
+}
+
+// saveUser сохраняет информацию о пользователе и обновляет его username и имя
+func saveUser(ctx context.Context, db interfaces.Database, user *tgbotapi.User) error {
 	if user == nil {
 		return nil
 	}
-	return db.AddUser(user.ID, user.UserName)
+	return db.UpsertUser(ctx, &models.User{
+		UserID:       user.ID,
+		Username:     user.UserName,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		LanguageCode: user.LanguageCode,
+	})
 }
 
 // saveChat сохраняет информацию о чате
-func saveChat(db interfaces.Database, chat *tgbotapi.Chat) error {
+func saveChat(ctx context.Context, db interfaces.Database, chat *tgbotapi.Chat) error {
 	if chat == nil {
 		return nil
 	}
@@ -53,27 +112,199 @@ func saveChat(db interfaces.Database, chat *tgbotapi.Chat) error {
 		title = chat.Title
 	}
 
-	return db.AddChat(chat.ID, title)
+	err := db.AddChat(ctx, chat.ID, title)
+	// Удаленные администратором чаты не восстанавливаются автоматически
+	if errors.Is(err, interfaces.ErrDeleted) {
+		return nil
+	}
+	return err
 }
 
-func saveUserChatRelation(db interfaces.Database, user *tgbotapi.User, chat *tgbotapi.Chat) error {
+func saveUserChatRelation(ctx context.Context, db interfaces.Database, user *tgbotapi.User, chat *tgbotapi.Chat) error {
 	if user == nil || chat == nil {
 		return nil
 	}
-	err := db.AddUserToChat(user.ID, chat.ID)
+	err := db.AddUserToChat(ctx, user.ID, chat.ID)
 	// Игнорируем ошибку о том, что пользователь уже существует в чате
 	if err != nil && strings.Contains(err.Error(), "пользователь уже существует в этом чате") {
 		return nil
 	}
+	// Связи с удаленными пользователями и чатами не создаются
+	if errors.Is(err, interfaces.ErrDeleted) {
+		return nil
+	}
 	return err
 }
 
+// isChatMember проверяет, является ли статус участника статусом члена чата
+func isChatMember(member tgbotapi.ChatMember) bool {
+	switch member.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return member.IsMember
+	default:
+		return false
+	}
+}
+
+// handleNewChatMembers добавляет новых участников чата в базу
+func handleNewChatMembers(ctx context.Context, db interfaces.Database, chat *tgbotapi.Chat, users []tgbotapi.User) {
+	for i := range users {
+		user := &users[i]
+		if user.IsBot {
+			continue
+		}
+		if err := saveUser(ctx, db, user); err != nil {
+			log.Printf("Ошибка сохранения пользователя: %v", err)
+			continue
+		}
+		if err := saveUserChatRelation(ctx, db, user, chat); err != nil {
+			log.Printf("Ошибка сохранения связи пользователя с чатом: %v", err)
+		}
+	}
+}
+
+// handleLeftChatMember удаляет связь покинувшего чат пользователя с чатом
+func handleLeftChatMember(ctx context.Context, db interfaces.Database, chat *tgbotapi.Chat, user *tgbotapi.User) {
+	if user == nil || chat == nil {
+		return
+	}
+	if err := db.RemoveUserFromChat(ctx, user.ID, chat.ID); err != nil {
+		log.Printf("Ошибка удаления связи пользователя с чатом: %v", err)
+	}
+}
+
+// handleChatMemberUpdate обрабатывает изменение статуса участника чата
+func handleChatMemberUpdate(ctx context.Context, db interfaces.Database, telegramBot *bot.TelegramBot, update *tgbotapi.ChatMemberUpdated) {
+	// Статус участника мог измениться на администратора или обратно
+	telegramBot.InvalidateChatAdmins(update.Chat.ID)
+
+	user := update.NewChatMember.User
+	if user == nil || user.IsBot {
+		return
+	}
+	if err := saveChat(ctx, db, &update.Chat); err != nil {
+		log.Printf("Ошибка сохранения чата: %v", err)
+	}
+
+	if isChatMember(update.NewChatMember) {
+		handleNewChatMembers(ctx, db, &update.Chat, []tgbotapi.User{*user})
+	} else {
+		handleLeftChatMember(ctx, db, &update.Chat, user)
+	}
+}
+
+// handleMyChatMemberUpdate отслеживает добавление и удаление бота из чата
+func handleMyChatMemberUpdate(ctx context.Context, db interfaces.Database, update *tgbotapi.ChatMemberUpdated) {
+	if err := saveChat(ctx, db, &update.Chat); err != nil {
+		log.Printf("Ошибка сохранения чата: %v", err)
+		return
+	}
+
+	active := isChatMember(update.NewChatMember)
+	if err := db.SetChatActive(ctx, update.Chat.ID, active); err != nil && !errors.Is(err, interfaces.ErrDeleted) {
+		log.Printf("Ошибка изменения статуса чата: %v", err)
+	}
+}
+
+// handleUpdate сохраняет пользователей и чаты из обновления и передает его боту.
+// Обработка одного обновления ограничена timeout, чтобы зависший запрос к базе не останавливал цикл.
+func handleUpdate(ctx context.Context, db interfaces.Database, telegramBot *bot.TelegramBot, timeout time.Duration, update tgbotapi.Update) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if update.InlineQuery != nil {
+		if err := saveUser(ctx, db, update.InlineQuery.From); err != nil {
+			log.Printf("Ошибка сохранения пользователя: %v", err)
+		}
+		telegramBot.HandleInlineQuery(ctx, update)
+		return
+	}
+
+	if update.MyChatMember != nil {
+		handleMyChatMemberUpdate(ctx, db, update.MyChatMember)
+		return
+	}
+
+	if update.ChatMember != nil {
+		handleChatMemberUpdate(ctx, db, telegramBot, update.ChatMember)
+		return
+	}
+
+	if update.Message != nil {
+		// Сохраняем информацию о пользователе и чате
+		if err := saveUser(ctx, db, update.Message.From); err != nil {
+			log.Printf("Ошибка сохранения пользователя: %v", err)
+		}
+		if err := saveChat(ctx, db, update.Message.Chat); err != nil {
+			log.Printf("Ошибка сохранения чата: %v", err)
+		}
+		// Сохраняем связь пользователя с чатом
+		if err := saveUserChatRelation(ctx, db, update.Message.From, update.Message.Chat); err != nil {
+			log.Printf("Ошибка сохранения связи пользователя с чатом: %v", err)
+		}
+
+		// Отслеживаем вход и выход участников
+		if len(update.Message.NewChatMembers) > 0 {
+			handleNewChatMembers(ctx, db, update.Message.Chat, update.Message.NewChatMembers)
+		}
+		if update.Message.LeftChatMember != nil {
+			handleLeftChatMember(ctx, db, update.Message.Chat, update.Message.LeftChatMember)
+		}
+
+		// Обрабатываем команду
+		if update.Message.IsCommand() {
+			telegramBot.HandleCommand(ctx, update)
+		} else {
+			// Ответы на шаги пошагового ввода в админ-панели
+			telegramBot.HandleMessage(ctx, update)
+		}
+	}
+
+	if update.CallbackQuery != nil {
+		// Сохраняем информацию о пользователе и чате для callback query
+		if err := saveUser(ctx, db, update.CallbackQuery.From); err != nil {
+			log.Printf("Ошибка сохранения пользователя: %v", err)
+		}
+		if err := saveChat(ctx, db, update.CallbackQuery.Message.Chat); err != nil {
+			log.Printf("Ошибка сохранения чата: %v", err)
+		}
+		// Сохраняем связь пользователя с чатом
+		if err := saveUserChatRelation(ctx, db, update.CallbackQuery.From, update.CallbackQuery.Message.Chat); err != nil {
+			log.Printf("Ошибка сохранения связи пользователя с чатом: %v", err)
+		}
+
+		// Обрабатываем callback query
+		telegramBot.HandleCallbackQuery(ctx, update)
+	}
+}
+
 func main() {
+	migrate := flag.String("migrate", "", "выполнить миграции и выйти: up - применить, down - откатить последнюю, status - показать состояние")
+	flag.Parse()
+
+	// Контекст отменяется при остановке процесса
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Инициализация базы данных
-	db, err := database.NewSQLiteDB("data/bot.db")
+	db, err := openDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
+	// С флагом -migrate выполняется только указанная команда: автоматическое применение
+	// миграций ниже пропускается, иначе -migrate down или status сначала применили бы все миграции
+	if *migrate != "" {
+		if err := runMigrate(ctx, db, *migrate); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// Без флага -migrate непримененные миграции применяются при каждом запуске
+	if err := db.MigrateUp(ctx); err != nil {
+		log.Fatal(err)
+	}
 
 	// Получение конфигурации
 	botToken := getEnv("BOT_TOKEN", "5818425786:AAHU4OQYccUuhfRrJRg0UOjokjwIDDOa-jU")
@@ -88,59 +319,51 @@ func main() {
 		log.Fatal("Ошибка преобразования ADMIN_ID в число:", err)
 	}
 
+	chatCooldown, err := time.ParseDuration(getEnv("MENTION_COOLDOWN_CHAT", "10m"))
+	if err != nil {
+		log.Fatal("Ошибка разбора MENTION_COOLDOWN_CHAT:", err)
+	}
+	userCooldown, err := time.ParseDuration(getEnv("MENTION_COOLDOWN_USER", "0s"))
+	if err != nil {
+		log.Fatal("Ошибка разбора MENTION_COOLDOWN_USER:", err)
+	}
+
+	updateTimeout, err := time.ParseDuration(getEnv("UPDATE_TIMEOUT", "30s"))
+	if err != nil {
+		log.Fatal("Ошибка разбора UPDATE_TIMEOUT:", err)
+	}
+
 	// Создание бота
 	telegramBot, err := bot.NewTelegramBot(botToken, adminID, db)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if err := telegramBot.RegisterCommands(ctx); err != nil {
+		log.Printf("%v", err)
+	}
+
+	// Ограничение частоты массовых упоминаний
+	mentionCooldown := bot.Cooldown{PerChat: chatCooldown, PerUser: userCooldown}
+	telegramBot.SetCooldown("all", mentionCooldown)
+	telegramBot.SetCooldown("group", mentionCooldown)
+
 	// Настройка обновлений
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
+	// chat_member не присылается по умолчанию, поэтому перечисляем типы обновлений явно
+	u.AllowedUpdates = []string{"message", "callback_query", "inline_query", "chat_member", "my_chat_member"}
 
 	// Обработка обновлений
 	updates := telegramBot.GetUpdatesChan(u)
 	log.Printf("start bot")
-	for update := range updates {
-		if update.InlineQuery != nil {
-			telegramBot.HandleInlineQuery(update)
-			continue
-		}
-
-		if update.Message != nil {
-			// Сохраняем информацию о пользователе и чате
-			if err := saveUser(db, update.Message.From); err != nil {
-				log.Printf("Ошибка сохранения пользователя: %v", err)
-			}
-			if err := saveChat(db, update.Message.Chat); err != nil {
-				log.Printf("Ошибка сохранения чата: %v", err)
-			}
-			// Сохраняем связь пользователя с чатом
-			if err := saveUserChatRelation(db, update.Message.From, update.Message.Chat); err != nil {
-				log.Printf("Ошибка сохранения связи пользователя с чатом: %v", err)
-			}
-
-			// Обрабатываем команду
-			if update.Message.IsCommand() {
-				telegramBot.HandleCommand(update)
-			}
-		}
-
-		if update.CallbackQuery != nil {
-			// Сохраняем информацию о пользователе и чате для callback query
-			if err := saveUser(db, update.CallbackQuery.From); err != nil {
-				log.Printf("Ошибка сохранения пользователя: %v", err)
-			}
-			if err := saveChat(db, update.CallbackQuery.Message.Chat); err != nil {
-				log.Printf("Ошибка сохранения чата: %v", err)
-			}
-			// Сохраняем связь пользователя с чатом
-			if err := saveUserChatRelation(db, update.CallbackQuery.From, update.CallbackQuery.Message.Chat); err != nil {
-				log.Printf("Ошибка сохранения связи пользователя с чатом: %v", err)
-			}
-
-			// Обрабатываем callback query
-			telegramBot.HandleCallbackQuery(update)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("stop bot")
+			return
+		case update := <-updates:
+			handleUpdate(ctx, db, telegramBot, updateTimeout, update)
 		}
 	}
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"weveryone_bot_v2/database/dbtest"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TestSaveUserKeepsAdminUsername проверяет, что обновления из Telegram
+// не возвращают username, измененный администратором
+func TestSaveUserKeepsAdminUsername(t *testing.T) {
+	ctx := context.Background()
+	db := dbtest.NewMemoryDB()
+	from := &tgbotapi.User{ID: 1, UserName: "telegram", FirstName: "Alice"}
+
+	if err := saveUser(ctx, db, from); err != nil {
+		t.Fatalf("saveUser: %v", err)
+	}
+	if err := db.SetUsername(ctx, 1, "renamed"); err != nil {
+		t.Fatalf("SetUsername: %v", err)
+	}
+	from.FirstName = "Alicia"
+	if err := saveUser(ctx, db, from); err != nil {
+		t.Fatalf("saveUser: %v", err)
+	}
+
+	user, err := db.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.Username != "renamed" {
+		t.Errorf("username администратора перезаписан: %q", user.Username)
+	}
+	if user.FirstName != "Alicia" {
+		t.Errorf("имя пользователя не обновлено: %q", user.FirstName)
+	}
+}
+
+func TestGetEnvTrimsSpaces(t *testing.T) {
+	t.Setenv("MENTION_COOLDOWN_USER", "0s ")
+	if value := getEnv("MENTION_COOLDOWN_USER", "1m"); value != "0s" {
+		t.Errorf("getEnv вернул %q", value)
+	}
+	t.Setenv("MENTION_COOLDOWN_USER", " ")
+	if value := getEnv("MENTION_COOLDOWN_USER", "1m"); value != "1m" {
+		t.Errorf("для пустого значения getEnv вернул %q", value)
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+// BulkResult - результат массового добавления пользователей в чат или группу
+type BulkResult struct {
+	// Added - пользователи, для которых связь создана
+	Added []int64
+	// Existing - пользователи, у которых связь уже была
+	Existing []int64
+	// Unknown - пользователи, которых нет в базе или которые удалены
+	Unknown []int64
+}
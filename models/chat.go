@@ -4,7 +4,9 @@ import "gorm.io/gorm"
 
 type Chat struct {
 	gorm.Model
-	ChatID   int64  `gorm:"uniqueIndex"`
-	Title    string
-	Users    []User `gorm:"many2many:chat_users;"`
-} 
\ No newline at end of file
+	ChatID int64 `gorm:"uniqueIndex"`
+	Title  string
+	Active bool `gorm:"default:true"`
+	// Users загружается через Preload из таблицы связей user_chats
+	Users []User `gorm:"many2many:user_chats;foreignKey:ChatID;joinForeignKey:ChatID;references:UserID;joinReferences:UserID"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Conversation хранит состояние пошагового ввода данных пользователем (например, создания чата).
+// У пользователя может быть только один активный диалог.
+type Conversation struct {
+	UserID int64 `gorm:"primaryKey"`
+	// ChatID - чат, в котором идет диалог
+	ChatID int64
+	// Flow - название сценария, Step - номер текущего шага
+	Flow string
+	Step int
+	// Data - введенные значения в формате JSON
+	Data      string
+	ExpiresAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+// Expired проверяет, истек ли срок ожидания ввода
+func (c *Conversation) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// CommandUsage хранит время последнего использования команды в чате.
+// Для ограничения на уровне всего чата UserID равен 0.
+type CommandUsage struct {
+	Command string `gorm:"primaryKey"`
+	ChatID  int64  `gorm:"primaryKey"`
+	UserID  int64  `gorm:"primaryKey"`
+	UsedAt  time.Time
+}
@@ -4,7 +4,8 @@ import "gorm.io/gorm"
 
 type Group struct {
 	gorm.Model
-	Name     string `gorm:"uniqueIndex"`
-	Users    []User `gorm:"many2many:group_users;"`
-	Chats    []Chat `gorm:"many2many:chat_groups;"`
-} 
\ No newline at end of file
+	Name string `gorm:"uniqueIndex"`
+	// Users и Chats загружаются через Preload из таблиц связей user_groups и group_chats
+	Users []User `gorm:"many2many:user_groups;joinForeignKey:GroupID;references:UserID;joinReferences:UserID"`
+	Chats []Chat `gorm:"many2many:group_chats;joinForeignKey:GroupID;references:ChatID;joinReferences:ChatID"`
+}
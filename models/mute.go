@@ -0,0 +1,83 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// GlobalMuteChatID - значение ChatID для отключения упоминаний во всех чатах
+const GlobalMuteChatID int64 = 0
+
+// MentionMute описывает отказ пользователя от массовых упоминаний.
+// Если QuietFrom и QuietTo не заданы, упоминания отключены всегда,
+// иначе - только в указанный промежуток времени в часовом поясе Timezone.
+type MentionMute struct {
+	UserID    int64 `gorm:"primaryKey"`
+	ChatID    int64 `gorm:"primaryKey"`
+	QuietFrom string
+	QuietTo   string
+	Timezone  string
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// IsGlobal возвращает true, если упоминания отключены во всех чатах
+func (m MentionMute) IsGlobal() bool {
+	return m.ChatID == GlobalMuteChatID
+}
+
+// HasWindow возвращает true, если отключение действует только в тихие часы
+func (m MentionMute) HasWindow() bool {
+	return m.QuietFrom != "" && m.QuietTo != ""
+}
+
+// ActiveAt проверяет, действует ли отключение упоминаний в момент t
+func (m MentionMute) ActiveAt(t time.Time) bool {
+	if !m.HasWindow() {
+		return true
+	}
+
+	from, err := ParseClock(m.QuietFrom)
+	if err != nil {
+		return false
+	}
+	to, err := ParseClock(m.QuietTo)
+	if err != nil {
+		return false
+	}
+
+	loc := time.Local
+	if m.Timezone != "" {
+		if l, err := time.LoadLocation(m.Timezone); err == nil {
+			loc = l
+		}
+	}
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+
+	if from <= to {
+		return now >= from && now < to
+	}
+	// Промежуток через полночь, например 23:00-08:00
+	return now >= from || now < to
+}
+
+// Describe возвращает описание отключения для отображения
+func (m MentionMute) Describe() string {
+	if !m.HasWindow() {
+		return "всегда"
+	}
+	tz := m.Timezone
+	if tz == "" {
+		tz = time.Local.String()
+	}
+	return fmt.Sprintf("с %s до %s (%s)", m.QuietFrom, m.QuietTo, tz)
+}
+
+// ParseClock разбирает время в формате ЧЧ:ММ и возвращает количество минут от полуночи
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("неверный формат времени %q, ожидается ЧЧ:ММ", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	valid := map[string]int{"00:00": 0, "08:30": 510, "23:59": 1439}
+	for value, want := range valid {
+		got, err := ParseClock(value)
+		if err != nil || got != want {
+			t.Errorf("ParseClock(%q) = %d, %v; ожидалось %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "24:00", "12:60", "1200", "ab:cd", "12:00:00"} {
+		if _, err := ParseClock(value); err == nil {
+			t.Errorf("ParseClock(%q) не вернул ошибку", value)
+		}
+	}
+}
+
+func TestMentionMuteActiveAt(t *testing.T) {
+	// at возвращает момент времени hh:mm 2 января 2024 года по UTC
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name string
+		mute MentionMute
+		at   time.Time
+		want bool
+	}{
+		{"без окна", MentionMute{}, at(12, 0), true},
+		{"внутри дневного окна", MentionMute{QuietFrom: "09:00", QuietTo: "18:00", Timezone: "UTC"}, at(12, 0), true},
+		{"начало окна включается", MentionMute{QuietFrom: "09:00", QuietTo: "18:00", Timezone: "UTC"}, at(9, 0), true},
+		{"конец окна не включается", MentionMute{QuietFrom: "09:00", QuietTo: "18:00", Timezone: "UTC"}, at(18, 0), false},
+		{"до дневного окна", MentionMute{QuietFrom: "09:00", QuietTo: "18:00", Timezone: "UTC"}, at(8, 59), false},
+
+		// Окно через полночь
+		{"ночь до полуночи", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "UTC"}, at(23, 30), true},
+		{"ночь после полуночи", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "UTC"}, at(2, 0), true},
+		{"полночь", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "UTC"}, at(0, 0), true},
+		{"утро после ночного окна", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "UTC"}, at(8, 0), false},
+		{"день при ночном окне", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "UTC"}, at(12, 0), false},
+
+		// Совпадающие начало и конец задают пустое окно
+		{"пустое окно в его начале", MentionMute{QuietFrom: "10:00", QuietTo: "10:00", Timezone: "UTC"}, at(10, 0), false},
+		{"пустое окно в другое время", MentionMute{QuietFrom: "10:00", QuietTo: "10:00", Timezone: "UTC"}, at(3, 0), false},
+
+		// Окно считается в часовом поясе пользователя: 21:00 UTC - полночь в Москве
+		{"часовой пояс внутри окна", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "Europe/Moscow"}, at(21, 0), true},
+		{"часовой пояс вне окна", MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "Europe/Moscow"}, at(6, 0), false},
+
+		// Испорченное время в базе не отключает упоминания
+		{"неверное время", MentionMute{QuietFrom: "25:00", QuietTo: "08:00", Timezone: "UTC"}, at(2, 0), false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.mute.ActiveAt(tc.at); got != tc.want {
+			t.Errorf("%s: ActiveAt(%s) = %v, ожидалось %v", tc.name, tc.at.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+// TestMentionMuteInvalidTimezone проверяет, что неизвестный часовой пояс заменяется местным временем сервера
+func TestMentionMuteInvalidTimezone(t *testing.T) {
+	invalid := MentionMute{QuietFrom: "23:00", QuietTo: "08:00", Timezone: "Mars/Base"}
+	local := MentionMute{QuietFrom: "23:00", QuietTo: "08:00"}
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for minutes := 0; minutes < 24*60; minutes += 30 {
+		now := start.Add(time.Duration(minutes) * time.Minute)
+		if invalid.ActiveAt(now) != local.ActiveAt(now) {
+			t.Fatalf("в %s неизвестный часовой пояс дает другой результат, чем местное время", now.Format("15:04"))
+		}
+	}
+}
@@ -12,13 +12,13 @@ type UserChat struct {
 // UserGroup представляет связь между пользователем и группой
 type UserGroup struct {
 	UserID    int64     `gorm:"primaryKey"`
-	GroupName string    `gorm:"primaryKey"`
+	GroupID   uint      `gorm:"primaryKey"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
 }
 
 // GroupChat представляет связь между группой и чатом
 type GroupChat struct {
-	GroupName string    `gorm:"primaryKey"`
+	GroupID   uint      `gorm:"primaryKey"`
 	ChatID    int64     `gorm:"primaryKey"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
-} 
\ No newline at end of file
+}
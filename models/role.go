@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Роли пользователей бота
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	// RoleManager выдается для конкретного чата
+	RoleManager = "manager"
+)
+
+// UserRole описывает роль пользователя. Для глобальных ролей ChatID равен 0,
+// для роли менеджера - ID чата, которым он управляет.
+type UserRole struct {
+	UserID    int64     `gorm:"primaryKey"`
+	Role      string    `gorm:"primaryKey"`
+	ChatID    int64     `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
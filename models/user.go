@@ -1,9 +1,40 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	UserID   int64  `gorm:"uniqueIndex"`
-	Username string
-} 
\ No newline at end of file
+	UserID       int64 `gorm:"uniqueIndex"`
+	Username     string
+	FirstName    string
+	LastName     string
+	LanguageCode string
+	// UsernameLocked - username задан администратором и не обновляется из Telegram
+	UsernameLocked bool `gorm:"default:false"`
+}
+
+// UsernameHistory хранит предыдущие username пользователя
+type UsernameHistory struct {
+	ID        uint  `gorm:"primaryKey"`
+	UserID    int64 `gorm:"index"`
+	Username  string
+	ChangedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// DisplayName возвращает имя пользователя для отображения
+func (u User) DisplayName() string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name != "" {
+		return name
+	}
+	if u.Username != "" {
+		return u.Username
+	}
+	return fmt.Sprintf("id%d", u.UserID)
+}